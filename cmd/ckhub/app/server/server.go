@@ -6,6 +6,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/uclatall/ckhub/pkg/logging"
+	"github.com/uclatall/ckhub/pkg/metrics"
 	"github.com/uclatall/ckhub/pkg/runtime"
 	"github.com/uclatall/ckhub/sandbox"
 	"github.com/uclatall/ckhub/sandbox/server"
@@ -32,14 +33,22 @@ func NewCommand(version string) *cobra.Command {
 				return err
 			}
 
+			registry := metrics.NewRegistry()
+
 			mgr, err := sandbox.NewManager(
 				sandbox.Logger(log.Name("sandbox")),
+				sandbox.Metrics(registry),
 				cfg.Sandbox,
 			)
+			if err != nil {
+				log.Error("server interrupted", logging.Error(err))
+				return err
+			}
 
 			srv, err := server.NewServer(
 				mgr,
 				server.Logger(log.Name("sandbox")),
+				server.Metrics(registry),
 				cfg.Server,
 			)
 			if err != nil {
@@ -3,9 +3,12 @@ package jupyter
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"go.uber.org/multierr"
@@ -15,6 +18,8 @@ import (
 type Client struct {
 	http  *resty.Client
 	token string
+
+	observer ObserverFunc
 }
 
 // NewClient creates a new jupyter client with the given options.
@@ -41,7 +46,9 @@ type createRequest struct {
 }
 
 // CreateKernel creates a new jupyter kernel with the given name.
-func (client *Client) CreateKernel(ctx context.Context, name string) (*Kernel, error) {
+func (client *Client) CreateKernel(ctx context.Context, name string) (_ *Kernel, rerr error) {
+	defer client.observe("create_kernel", time.Now(), &rerr)
+
 	uri, err := url.Parse(client.http.BaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid server url: %w", err)
@@ -66,6 +73,7 @@ func (client *Client) CreateKernel(ctx context.Context, name string) (*Kernel, e
 
 	kernel := &result.Result
 
+	kernel.client = client
 	kernel.Address = res.Request.TraceInfo().RemoteAddr
 
 	uri.Scheme = "ws"
@@ -83,23 +91,19 @@ func (client *Client) CreateKernel(ctx context.Context, name string) (*Kernel, e
 }
 
 // RemoveKernel removes the jupyter kernel with the given identifier.
-func (client *Client) RemoveKernel(ctx context.Context, kernel *Kernel) error {
+func (client *Client) RemoveKernel(ctx context.Context, kernel *Kernel) (rerr error) {
+	defer client.observe("remove_kernel", time.Now(), &rerr)
+
 	var result Response[json.RawMessage]
 
-	uri, err := url.Parse(client.http.BaseURL)
+	req, err := client.kernelRequest(ctx, kernel)
 	if err != nil {
-		return fmt.Errorf("invalid server url: %w", err)
+		return err
 	}
-	hostname := uri.Hostname()
-	uri.Host = kernel.Address.String()
 
-	res, err := resty.New().SetBaseURL(uri.String()).SetAuthScheme("token").R().
-		SetContext(ctx).
-		SetAuthToken(client.token).
+	res, err := req.
 		SetError(&result.Error).
-		SetHeader("host", hostname).
 		SetResult(&result.Result).
-		SetPathParam("id", kernel.ID.String()).
 		Delete("/api/kernels/{id}")
 	if err != nil {
 		return fmt.Errorf("failed to process request: %w", err)
@@ -111,6 +115,138 @@ func (client *Client) RemoveKernel(ctx context.Context, kernel *Kernel) error {
 	return nil
 }
 
+// ErrKernelNotFound is returned when the kernel does not exist on the server.
+var ErrKernelNotFound = errors.New("kernel not found")
+
+type stateResponse struct {
+	ExecutionState string `json:"execution_state"`
+}
+
+// KernelState returns the execution state of the jupyter kernel, as it is
+// reported by the jupyter server.
+func (client *Client) KernelState(ctx context.Context, kernel *Kernel) (_ State, rerr error) {
+	defer client.observe("kernel_state", time.Now(), &rerr)
+
+	var result Response[stateResponse]
+
+	req, err := client.kernelRequest(ctx, kernel)
+	if err != nil {
+		return StateNone, err
+	}
+
+	res, err := req.
+		SetError(&result.Error).
+		SetResult(&result.Result).
+		Get("/api/kernels/{id}")
+	if err != nil {
+		return StateNone, fmt.Errorf("failed to process request: %w", err)
+	}
+	if res.StatusCode() == http.StatusNotFound {
+		return StateNone, ErrKernelNotFound
+	}
+	if !res.IsSuccess() {
+		return StateNone, fmt.Errorf("invalid server response: %w", result.Error)
+	}
+
+	var state State
+	err = state.UnmarshalText([]byte(result.Result.ExecutionState))
+	if err != nil {
+		return StateNone, nil
+	}
+	return state, nil
+}
+
+// InterruptKernel interrupts the jupyter kernel through the jupyter server,
+// regardless of the interrupt mode of the kernel.
+func (client *Client) InterruptKernel(ctx context.Context, kernel *Kernel) (rerr error) {
+	defer client.observe("interrupt_kernel", time.Now(), &rerr)
+
+	var result Response[json.RawMessage]
+
+	req, err := client.kernelRequest(ctx, kernel)
+	if err != nil {
+		return err
+	}
+
+	res, err := req.
+		SetError(&result.Error).
+		SetResult(&result.Result).
+		Post("/api/kernels/{id}/interrupt")
+	if err != nil {
+		return fmt.Errorf("failed to process request: %w", err)
+	}
+	if res.StatusCode() == http.StatusNotFound {
+		return ErrKernelNotFound
+	}
+	if !res.IsSuccess() {
+		return fmt.Errorf("invalid server response: %w", result.Error)
+	}
+
+	return nil
+}
+
+// KernelSpec describes a kernel available on the jupyter server.
+type KernelSpec struct {
+	Name string `json:"name"`
+	Spec struct {
+		DisplayName   string         `json:"display_name"`
+		Language      string         `json:"language"`
+		InterruptMode string         `json:"interrupt_mode,omitempty"`
+		MetaData      map[string]any `json:"metadata,omitempty"`
+	} `json:"spec"`
+}
+
+// KernelSpecs represents kernels available on the jupyter server.
+type KernelSpecs struct {
+	Default     string                `json:"default"`
+	KernelSpecs map[string]KernelSpec `json:"kernelspecs"`
+}
+
+// KernelSpecs returns kernels available on the jupyter server.
+func (client *Client) KernelSpecs(ctx context.Context) (_ *KernelSpecs, rerr error) {
+	defer client.observe("kernel_specs", time.Now(), &rerr)
+
+	var result Response[KernelSpecs]
+
+	res, err := client.http.R().
+		SetContext(ctx).
+		SetAuthToken(client.token).
+		SetError(&result.Error).
+		SetResult(&result.Result).
+		Get("/api/kernelspecs")
+	if err != nil {
+		return nil, fmt.Errorf("failed to process request: %w", err)
+	}
+	if !res.IsSuccess() {
+		return nil, fmt.Errorf("invalid server response: %w", result.Error)
+	}
+
+	return &result.Result, nil
+}
+
+func (client *Client) observe(operation string, start time.Time, err *error) {
+	if client.observer != nil {
+		client.observer(operation, time.Since(start), *err)
+	}
+}
+
+// kernelRequest creates a new request to the jupyter server that hosts the
+// given kernel.
+func (client *Client) kernelRequest(ctx context.Context, kernel *Kernel) (*resty.Request, error) {
+	uri, err := url.Parse(client.http.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server url: %w", err)
+	}
+	hostname := uri.Hostname()
+	uri.Host = kernel.Address.String()
+
+	return resty.New().SetBaseURL(uri.String()).SetAuthScheme("token").R().
+		SetContext(ctx).
+		SetAuthToken(client.token).
+		SetHeader("host", hostname).
+		SetPathParam("id", kernel.ID.String()), nil
+}
+
 // Response describes a jupyter server response.
 type Response[T any] struct {
 	Error  Error
@@ -0,0 +1,149 @@
+package jupyter_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uclatall/ckhub/pkg/jupyter"
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+)
+
+func newClient(t *testing.T, srv *jupytertest.Server) *jupyter.Client {
+	t.Helper()
+
+	client, err := jupyter.NewClient(srv.Config())
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	return client
+}
+
+func TestClientCreateKernel(t *testing.T) {
+	srv := jupytertest.NewServer("secret", nil)
+	defer srv.Close()
+
+	client := newClient(t, srv)
+
+	kernel, err := client.CreateKernel(context.Background(), "python3")
+	if err != nil {
+		t.Fatalf("failed to create kernel: %v", err)
+	}
+	if kernel.Name != "python3" {
+		t.Errorf("unexpected kernel name: %q", kernel.Name)
+	}
+	if kernel.Address == nil {
+		t.Error("kernel address is not set")
+	}
+	if srv.Kernel(kernel.ID) == nil {
+		t.Errorf("kernel %s does not exist on the server", kernel.ID)
+	}
+
+	state, err := client.KernelState(context.Background(), kernel)
+	if err != nil {
+		t.Fatalf("failed to get kernel state: %v", err)
+	}
+	if state != jupyter.StateIdle {
+		t.Errorf("unexpected kernel state: %s", state)
+	}
+
+	err = client.RemoveKernel(context.Background(), kernel)
+	if err != nil {
+		t.Fatalf("failed to remove kernel: %v", err)
+	}
+
+	_, err = client.KernelState(context.Background(), kernel)
+	if !errors.Is(err, jupyter.ErrKernelNotFound) {
+		t.Errorf("unexpected error of removed kernel state: %v", err)
+	}
+}
+
+func TestClientCreateKernelFailure(t *testing.T) {
+	srv := jupytertest.NewServer("secret", nil)
+	defer srv.Close()
+
+	srv.FailCreate(1)
+
+	client := newClient(t, srv)
+
+	_, err := client.CreateKernel(context.Background(), "python3")
+	if err == nil {
+		t.Fatal("expected kernel creation to fail")
+	}
+
+	_, err = client.CreateKernel(context.Background(), "python3")
+	if err != nil {
+		t.Fatalf("failed to create kernel after failure: %v", err)
+	}
+}
+
+func TestClientUnauthorized(t *testing.T) {
+	srv := jupytertest.NewServer("secret", nil)
+	defer srv.Close()
+
+	client, err := jupyter.NewClient(jupyter.Config{Address: srv.URL(), Token: "invalid"})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	_, err = client.CreateKernel(context.Background(), "python3")
+	if err == nil {
+		t.Fatal("expected kernel creation to fail")
+	}
+	if srv.Created() != 0 {
+		t.Errorf("unexpected number of created kernels: %d", srv.Created())
+	}
+}
+
+func TestClientObserver(t *testing.T) {
+	srv := jupytertest.NewServer("", nil)
+	defer srv.Close()
+
+	var operations []string
+	client, err := jupyter.NewClient(srv.Config(), jupyter.Observer(
+		func(operation string, _ time.Duration, err error) {
+			if err != nil {
+				operation += ":error"
+			}
+			operations = append(operations, operation)
+		},
+	))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	kernel, err := client.CreateKernel(context.Background(), "python3")
+	if err != nil {
+		t.Fatalf("failed to create kernel: %v", err)
+	}
+	_ = client.RemoveKernel(context.Background(), kernel)
+	_ = client.RemoveKernel(context.Background(), kernel)
+
+	expected := []string{"create_kernel", "remove_kernel", "remove_kernel:error"}
+	if strings.Join(operations, ",") != strings.Join(expected, ",") {
+		t.Errorf("unexpected observed operations: %v", operations)
+	}
+}
+
+func TestClientKernelSpecs(t *testing.T) {
+	srv := jupytertest.NewServer("secret", nil)
+	defer srv.Close()
+
+	specs, err := newClient(t, srv).KernelSpecs(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get kernel specs: %v", err)
+	}
+	if specs.Default != "python3" {
+		t.Errorf("unexpected default kernel: %q", specs.Default)
+	}
+	if spec, ok := specs.KernelSpecs["ir"]; !ok || spec.Spec.Language != "R" {
+		t.Errorf("unexpected kernel specs: %+v", specs.KernelSpecs)
+	}
+
+	_, err = newClient(t, srv).CreateKernel(context.Background(), "julia")
+	if err == nil {
+		t.Error("kernel of unknown spec is created")
+	}
+}
@@ -0,0 +1,7 @@
+// Package jupytertest provides an in-process fake jupyter server for tests.
+//
+// The server implements the subset of the jupyter server API used by ckhub:
+// kernels management endpoints and the kernel channels websocket. Kernels
+// reply to execute requests according to scriptable handlers, which allows
+// to simulate outputs, errors, delays, and failures.
+package jupytertest
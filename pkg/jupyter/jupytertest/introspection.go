@@ -0,0 +1,107 @@
+package jupytertest
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/uclatall/ckhub/pkg/jupyter"
+)
+
+// Introspection answers the introspection requests of the kernels. Nil
+// functions fall back to the default behavior.
+type Introspection struct {
+	// Complete returns the completion matches of the token before the cursor.
+	// There are no matches by default.
+	Complete func(token string) []string
+	// Inspect returns the MIME bundle describing the token at the cursor, or
+	// nil if the token is unknown. Tokens are unknown by default.
+	Inspect func(token string) map[string]any
+	// IsComplete returns the completeness status of the code. By default, code
+	// with unbalanced brackets is incomplete.
+	IsComplete func(code string) string
+}
+
+func (i Introspection) complete(
+	content jupyter.MessageCompleteRequestContent,
+) jupyter.MessageCompleteReplyContent {
+	token, start := tokenAt(content.Code, content.CursorPos)
+
+	var matches []string
+	if i.Complete != nil {
+		matches = i.Complete(token)
+	}
+	if matches == nil {
+		matches = []string{}
+	}
+
+	return jupyter.MessageCompleteReplyContent{
+		Status:      "ok",
+		Matches:     matches,
+		CursorStart: start,
+		CursorEnd:   content.CursorPos,
+		MetaData:    jupyter.MetaData{},
+	}
+}
+
+func (i Introspection) inspect(
+	content jupyter.MessageInspectRequestContent,
+) jupyter.MessageInspectReplyContent {
+	token, _ := tokenAt(content.Code, content.CursorPos)
+
+	var data map[string]any
+	if i.Inspect != nil {
+		data = i.Inspect(token)
+	}
+
+	return jupyter.MessageInspectReplyContent{
+		Status:   "ok",
+		Found:    data != nil,
+		Data:     data,
+		MetaData: jupyter.MetaData{},
+	}
+}
+
+func (i Introspection) isComplete(
+	content jupyter.MessageIsCompleteRequestContent,
+) jupyter.MessageIsCompleteReplyContent {
+	if i.IsComplete != nil {
+		return jupyter.MessageIsCompleteReplyContent{Status: i.IsComplete(content.Code)}
+	}
+
+	depth := 0
+	for _, r := range content.Code {
+		switch r {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		}
+	}
+	switch {
+	case depth > 0:
+		return jupyter.MessageIsCompleteReplyContent{Status: "incomplete", Indent: "  "}
+	case depth < 0:
+		return jupyter.MessageIsCompleteReplyContent{Status: "invalid"}
+	default:
+		return jupyter.MessageIsCompleteReplyContent{Status: "complete"}
+	}
+}
+
+// tokenAt returns the identifier ending at the given cursor position, and the
+// position of its start. Positions are counted in unicode characters.
+func tokenAt(code string, cursor int) (string, int) {
+	runes := []rune(code)
+	if cursor < 0 || cursor > len(runes) {
+		cursor = len(runes)
+	}
+
+	start := cursor
+	for start > 0 {
+		r := runes[start-1]
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("_.", r) {
+			break
+		}
+		start--
+	}
+	return string(runes[start:cursor]), start
+}
@@ -0,0 +1,433 @@
+package jupytertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/websocket"
+
+	"github.com/uclatall/ckhub/pkg/jupyter"
+)
+
+// Kernel is a fake jupyter kernel.
+type Kernel struct {
+	ID   uuid.UUID
+	Name string
+
+	info    jupyter.LanguageInfo
+	mode    string
+	handler Handler
+	intro   Introspection
+
+	mu         sync.Mutex
+	state      jupyter.State
+	conns      map[*websocket.Conn]*connection
+	requests   []Request
+	interrupts int
+	count      int
+	closed     chan struct{}
+}
+
+func newKernel(spec jupyter.KernelSpec, handler Handler, intro Introspection) *Kernel {
+	return &Kernel{
+		ID:      uuid.New(),
+		Name:    spec.Name,
+		info:    languageInfo(spec),
+		mode:    spec.Spec.InterruptMode,
+		handler: handler,
+		intro:   intro,
+		state:   jupyter.StateIdle,
+		conns:   make(map[*websocket.Conn]*connection),
+		closed:  make(chan struct{}),
+	}
+}
+
+// State returns the execution state reported by the server.
+func (k *Kernel) State() jupyter.State {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.state
+}
+
+// SetState overrides the execution state reported by the server.
+func (k *Kernel) SetState(state jupyter.State) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.state = state
+}
+
+// Request is an execute request received by the kernel.
+type Request struct {
+	Content  jupyter.MessageExecuteRequestContent
+	MetaData jupyter.MetaData
+}
+
+// Requests returns all execute requests received by the kernel.
+func (k *Kernel) Requests() []Request {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return append([]Request(nil), k.requests...)
+}
+
+// Executions returns the code of all execute requests received by the kernel.
+func (k *Kernel) Executions() []string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	executions := make([]string, len(k.requests))
+	for i, request := range k.requests {
+		executions[i] = request.Content.Code
+	}
+	return executions
+}
+
+// Interrupts returns the number of interrupts received by the kernel, either
+// as requests or from the server.
+func (k *Kernel) Interrupts() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.interrupts
+}
+
+// interrupt interrupts the executions of all kernel connections, as the
+// signal sent by the server does.
+func (k *Kernel) interrupt() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.interrupts++
+	for _, c := range k.conns {
+		c.signal()
+	}
+}
+
+type kernelModel struct {
+	ID             uuid.UUID     `json:"id"`
+	Name           string        `json:"name"`
+	ExecutionState jupyter.State `json:"execution_state"`
+	Connections    int           `json:"connections"`
+}
+
+func (k *Kernel) model() kernelModel {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return kernelModel{
+		ID:             k.ID,
+		Name:           k.Name,
+		ExecutionState: k.state,
+		Connections:    len(k.conns),
+	}
+}
+
+func (k *Kernel) close() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	select {
+	case <-k.closed:
+	default:
+		close(k.closed)
+	}
+
+	for conn := range k.conns {
+		_ = conn.Close()
+	}
+}
+
+// inbound is a loosely decoded message received from a client.
+type inbound struct {
+	Header struct {
+		MsgID   string `json:"msg_id"`
+		MsgType string `json:"msg_type"`
+	} `json:"header"`
+	MetaData jupyter.MetaData `json:"metadata"`
+	Channel  string           `json:"channel"`
+	Content  json.RawMessage  `json:"content"`
+}
+
+// outbound is a message sent to a client.
+type outbound struct {
+	Header       jupyter.Header       `json:"header"`
+	ParentHeader jupyter.ParentHeader `json:"parent_header"`
+	MetaData     jupyter.MetaData     `json:"metadata"`
+	Content      any                  `json:"content"`
+	Channel      jupyter.Channel      `json:"channel"`
+}
+
+// connection is a client connection to the kernel.
+type connection struct {
+	kernel *Kernel
+	conn   *websocket.Conn
+
+	mu        sync.Mutex
+	exec      sync.Mutex
+	inputs    chan string
+	interrupt chan struct{}
+	done      chan struct{}
+}
+
+func (k *Kernel) serve(conn *websocket.Conn) {
+	c := &connection{
+		kernel:    k,
+		conn:      conn,
+		inputs:    make(chan string, 1),
+		interrupt: make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+
+	k.mu.Lock()
+	k.conns[conn] = c
+	k.mu.Unlock()
+	defer func() {
+		close(c.done)
+		_ = conn.Close()
+
+		k.mu.Lock()
+		delete(k.conns, conn)
+		k.mu.Unlock()
+	}()
+
+	for {
+		var buf []byte
+		err := websocket.Message.Receive(conn, &buf)
+		if err != nil {
+			return
+		}
+
+		var msg inbound
+		err = json.Unmarshal(buf, &msg)
+		if err != nil {
+			return
+		}
+
+		switch msg.Header.MsgType {
+		case "execute_request":
+			var content jupyter.MessageExecuteRequestContent
+			_ = json.Unmarshal(msg.Content, &content)
+
+			k.mu.Lock()
+			k.requests = append(k.requests, Request{Content: content, MetaData: msg.MetaData})
+			k.mu.Unlock()
+
+			go c.execute(msg.Header.MsgID, content)
+		case "interrupt_request":
+			// Like real kernels, only kernels in the message mode handle
+			// interrupt requests.
+			if k.mode == jupyter.InterruptModeMessage {
+				k.mu.Lock()
+				k.interrupts++
+				k.mu.Unlock()
+
+				c.signal()
+			}
+			c.send(msg.Header.MsgID, jupyter.MsgTypeInterruptRequest, jupyter.ChannelControl,
+				jupyter.MsgTypeInterruptReply, map[string]string{"status": "ok"})
+		case "kernel_info_request":
+			c.send(msg.Header.MsgID, jupyter.MsgTypeKernelInfoRequest, jupyter.ChannelShell,
+				jupyter.MsgTypeKernelInfoReply, jupyter.MessageKernelInfoReplyContent{
+					Status:                "ok",
+					ProtocolVersion:       "5.3",
+					Implementation:        "jupytertest",
+					ImplementationVersion: "1.0",
+					LanguageInfo:          k.info,
+					Banner:                "Fake " + k.info.Name + " kernel",
+				})
+		case "complete_request":
+			var content jupyter.MessageCompleteRequestContent
+			_ = json.Unmarshal(msg.Content, &content)
+			c.send(msg.Header.MsgID, jupyter.MsgTypeCompleteRequest, jupyter.ChannelShell,
+				jupyter.MsgTypeCompleteReply, k.intro.complete(content))
+		case "inspect_request":
+			var content jupyter.MessageInspectRequestContent
+			_ = json.Unmarshal(msg.Content, &content)
+			c.send(msg.Header.MsgID, jupyter.MsgTypeInspectRequest, jupyter.ChannelShell,
+				jupyter.MsgTypeInspectReply, k.intro.inspect(content))
+		case "is_complete_request":
+			var content jupyter.MessageIsCompleteRequestContent
+			_ = json.Unmarshal(msg.Content, &content)
+			c.send(msg.Header.MsgID, jupyter.MsgTypeIsCompleteRequest, jupyter.ChannelShell,
+				jupyter.MsgTypeIsCompleteReply, k.intro.isComplete(content))
+		case "input_reply":
+			var content jupyter.MessageInputReplyContent
+			_ = json.Unmarshal(msg.Content, &content)
+
+			select {
+			case c.inputs <- content.Value:
+			default:
+			}
+		}
+	}
+}
+
+// signal interrupts the pending execution of the connection.
+func (c *connection) signal() {
+	select {
+	case c.interrupt <- struct{}{}:
+	default:
+	}
+}
+
+// execute runs the reply of the kernel handler to the execute request.
+func (c *connection) execute(parent string, request jupyter.MessageExecuteRequestContent) {
+	c.exec.Lock()
+	defer c.exec.Unlock()
+
+	// Drop interrupts that were not consumed by the execution.
+	defer func() {
+		select {
+		case <-c.interrupt:
+		default:
+		}
+	}()
+
+	k := c.kernel
+	k.mu.Lock()
+	k.count++
+	count := k.count
+	k.state = jupyter.StateBusy
+	k.mu.Unlock()
+
+	defer func() {
+		k.mu.Lock()
+		if k.state == jupyter.StateBusy {
+			k.state = jupyter.StateIdle
+		}
+		k.mu.Unlock()
+	}()
+
+	reply := k.handler(request.Code)
+
+	iopub := func(msgType jupyter.MsgType, content any) {
+		c.send(parent, jupyter.MsgTypeExecuteRequest, jupyter.ChannelIOPub, msgType, content)
+	}
+	finish := func(status string) {
+		content := jupyter.MessageExecuteReplyContent{Status: status, ExecutionCount: count}
+		if status == "ok" {
+			content.UserExpressions = evaluate(request.UserExpressions, reply.UserExpressions)
+		}
+		c.send(parent, jupyter.MsgTypeExecuteRequest, jupyter.ChannelShell, jupyter.MsgTypeExecuteReply, content)
+		iopub(jupyter.MsgTypeStatus, jupyter.MessageStatusContent{ExecutionState: jupyter.StateIdle})
+	}
+	interrupted := func() {
+		iopub(jupyter.MsgTypeError, jupyter.MessageErrorContent{
+			EName:     "KeyboardInterrupt",
+			EValue:    "",
+			Traceback: []string{"KeyboardInterrupt"},
+		})
+		finish("error")
+	}
+
+	iopub(jupyter.MsgTypeStatus, jupyter.MessageStatusContent{ExecutionState: jupyter.StateBusy})
+
+	for _, output := range reply.Outputs {
+		if output.Delay > 0 {
+			timer := time.NewTimer(output.Delay)
+			select {
+			case <-timer.C:
+			case <-c.interrupt:
+				timer.Stop()
+				interrupted()
+				return
+			case <-c.done:
+				timer.Stop()
+				return
+			}
+		}
+
+		if output.Type != jupyter.MsgTypeInputRequest {
+			iopub(output.Type, output.Content)
+			continue
+		}
+
+		c.send(parent, jupyter.MsgTypeExecuteRequest, jupyter.ChannelStdin, output.Type, output.Content)
+		select {
+		case value := <-c.inputs:
+			iopub(jupyter.MsgTypeStream, jupyter.MessageStreamContent{Name: "stdout", Text: value})
+		case <-c.interrupt:
+			interrupted()
+			return
+		case <-c.done:
+			return
+		}
+	}
+
+	if reply.Close {
+		_ = c.conn.Close()
+		return
+	}
+
+	if reply.Stuck {
+		<-k.closed
+		return
+	}
+	if reply.Hang {
+		select {
+		case <-c.interrupt:
+			interrupted()
+		case <-c.done:
+		}
+		return
+	}
+
+	status := reply.Status
+	if status == "" {
+		status = "ok"
+	}
+	finish(status)
+}
+
+// evaluate evaluates the requested user expressions using the given results.
+func evaluate(
+	requested map[string]string,
+	results map[string]jupyter.UserExpression,
+) map[string]jupyter.UserExpression {
+	values := make(map[string]jupyter.UserExpression, len(requested))
+	for name, expr := range requested {
+		value, ok := results[expr]
+		if !ok {
+			value = jupyter.UserExpression{
+				Status:    "error",
+				EName:     "NameError",
+				EValue:    fmt.Sprintf("name '%s' is not defined", expr),
+				Traceback: []string{"NameError"},
+			}
+		}
+		values[name] = value
+	}
+	return values
+}
+
+func (c *connection) send(parent string, parentType jupyter.MsgType, channel jupyter.Channel,
+	msgType jupyter.MsgType, content any,
+) {
+	buf, err := json.Marshal(outbound{
+		Header: jupyter.Header{
+			MsgID:   uuid.New().String(),
+			MsgType: msgType,
+			Version: "5.3",
+		},
+		ParentHeader: jupyter.ParentHeader{
+			MsgID:   parent,
+			MsgType: parentType,
+		},
+		MetaData: jupyter.MetaData{},
+		Content:  content,
+		Channel:  channel,
+	})
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_ = websocket.Message.Send(c.conn, string(buf))
+}
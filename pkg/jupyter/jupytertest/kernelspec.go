@@ -0,0 +1,90 @@
+package jupytertest
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/uclatall/ckhub/pkg/jupyter"
+)
+
+// languages contains language details reported by the kernels of the
+// well-known languages.
+var languages = map[string]jupyter.LanguageInfo{
+	"python": {
+		Name:          "python",
+		Version:       "3.11.4",
+		MimeType:      "text/x-python",
+		FileExtension: ".py",
+		PygmentsLexer: "ipython3",
+		CodemirrorMode: map[string]any{
+			"name":    "ipython",
+			"version": 3,
+		},
+		NbconvertExporter: "python",
+	},
+	"R": {
+		Name:           "R",
+		Version:        "4.3.1",
+		MimeType:       "text/x-r-source",
+		FileExtension:  ".r",
+		PygmentsLexer:  "r",
+		CodemirrorMode: "r",
+	},
+}
+
+// KernelSpec returns a spec of the kernel with the given name, which
+// implements the given language.
+func KernelSpec(name, language string) jupyter.KernelSpec {
+	spec := jupyter.KernelSpec{Name: name}
+	spec.Spec.DisplayName = name
+	spec.Spec.Language = language
+	spec.Spec.InterruptMode = jupyter.InterruptModeSignal
+	return spec
+}
+
+// defaultSpecs returns specs of the kernels available by default.
+func defaultSpecs() map[string]jupyter.KernelSpec {
+	return map[string]jupyter.KernelSpec{
+		"python3": KernelSpec("python3", "python"),
+		"ir":      KernelSpec("ir", "R"),
+	}
+}
+
+// languageInfo returns language details of the given kernel spec.
+func languageInfo(spec jupyter.KernelSpec) jupyter.LanguageInfo {
+	info, ok := languages[spec.Spec.Language]
+	if !ok {
+		info = jupyter.LanguageInfo{Name: spec.Spec.Language}
+	}
+	return info
+}
+
+// SetKernelSpecs replaces the kernels available on the server.
+func (srv *Server) SetKernelSpecs(specs ...jupyter.KernelSpec) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.specs = make(map[string]jupyter.KernelSpec, len(specs))
+	for _, spec := range specs {
+		srv.specs[spec.Name] = spec
+	}
+}
+
+func (srv *Server) listKernelSpecs(res http.ResponseWriter, _ *http.Request) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	names := make([]string, 0, len(srv.specs))
+	for name := range srv.specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := jupyter.KernelSpecs{KernelSpecs: srv.specs}
+	if _, ok := srv.specs["python3"]; ok {
+		result.Default = "python3"
+	} else if len(names) > 0 {
+		result.Default = names[0]
+	}
+	writeJSON(res, http.StatusOK, result)
+}
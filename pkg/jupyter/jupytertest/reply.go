@@ -0,0 +1,127 @@
+package jupytertest
+
+import (
+	"time"
+
+	"github.com/uclatall/ckhub/pkg/jupyter"
+)
+
+// Handler returns a reply of the kernel to the execute request with the given
+// code.
+type Handler func(code string) Reply
+
+// Reply describes a reply of the kernel to the execute request.
+type Reply struct {
+	// Outputs are published in order between the busy and idle statuses.
+	Outputs []Output
+	// Status is a status of the execute reply, defaults to "ok".
+	Status string
+	// Hang blocks the execution after the outputs until it is interrupted.
+	Hang bool
+	// Stuck blocks the execution after the outputs and ignores interrupts,
+	// so the kernel stays busy until it is closed.
+	Stuck bool
+	// Close drops the connection instead of completing the execution.
+	Close bool
+	// UserExpressions maps expressions to their evaluation results. Unknown
+	// expressions fail with NameError.
+	UserExpressions map[string]jupyter.UserExpression
+}
+
+// Output describes a message published by the kernel during execution.
+type Output struct {
+	Type    jupyter.MsgType
+	Content any
+	// Delay is waited before the message is published.
+	Delay time.Duration
+}
+
+// Echo is a handler that prints the executed code to stdout.
+func Echo(code string) Reply {
+	return Reply{Outputs: []Output{Stream("stdout", code)}}
+}
+
+// Value creates a successful evaluation result of the user expression.
+func Value(text string) jupyter.UserExpression {
+	return jupyter.UserExpression{
+		Status:   "ok",
+		Data:     map[string]any{"text/plain": text},
+		MetaData: jupyter.MetaData{},
+	}
+}
+
+// Stream creates an output of the stream message.
+func Stream(name, text string) Output {
+	return Output{
+		Type: jupyter.MsgTypeStream,
+		Content: jupyter.MessageStreamContent{
+			Name: name,
+			Text: text,
+		},
+	}
+}
+
+// DisplayData creates an output of the display data message. The display
+// identifier can be empty.
+func DisplayData(id string, data map[string]any) Output {
+	return Output{
+		Type: jupyter.MsgTypeDisplayData,
+		Content: jupyter.MessageDisplayDataContent{
+			Data:      data,
+			MetaData:  jupyter.MetaData{},
+			Transient: jupyter.Transient{DisplayID: id},
+		},
+	}
+}
+
+// UpdateDisplayData creates an output of the update display data message.
+func UpdateDisplayData(id string, data map[string]any) Output {
+	return Output{
+		Type: jupyter.MsgTypeUpdateDisplayData,
+		Content: jupyter.MessageDisplayDataContent{
+			Data:      data,
+			MetaData:  jupyter.MetaData{},
+			Transient: jupyter.Transient{DisplayID: id},
+		},
+	}
+}
+
+// ExecuteResult creates an output of the execute result message.
+func ExecuteResult(data map[string]any) Output {
+	return Output{
+		Type: jupyter.MsgTypeExecuteResult,
+		Content: jupyter.MessageExecuteResultContent{
+			Data:     data,
+			MetaData: jupyter.MetaData{},
+		},
+	}
+}
+
+// ClearOutput creates an output of the clear output message.
+func ClearOutput(wait bool) Output {
+	return Output{
+		Type:    jupyter.MsgTypeClearOutput,
+		Content: jupyter.MessageClearOutputContent{Wait: wait},
+	}
+}
+
+// Error creates an output of the error message.
+func Error(name, value string) Output {
+	return Output{
+		Type: jupyter.MsgTypeError,
+		Content: jupyter.MessageErrorContent{
+			EName:     name,
+			EValue:    value,
+			Traceback: []string{name + ": " + value},
+		},
+	}
+}
+
+// InputRequest creates an input request. The kernel waits for the input reply
+// and prints the received value to stdout.
+func InputRequest(prompt string) Output {
+	return Output{
+		Type:    jupyter.MsgTypeInputRequest,
+		Content: jupyter.MessageInputRequestContent{Prompt: prompt},
+	}
+}
@@ -0,0 +1,265 @@
+package jupytertest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"golang.org/x/net/websocket"
+
+	"github.com/uclatall/ckhub/pkg/jupyter"
+)
+
+// Server is a fake jupyter server.
+type Server struct {
+	server *httptest.Server
+	token  string
+
+	mu       sync.Mutex
+	handler  Handler
+	intro    Introspection
+	specs    map[string]jupyter.KernelSpec
+	kernels  map[uuid.UUID]*Kernel
+	failures int
+	created  int
+}
+
+// NewServer starts a new fake jupyter server that requires the given token.
+// An empty token disables the authentication. Kernels of the server reply
+// using the given handler, which defaults to Echo.
+func NewServer(token string, handler Handler) *Server {
+	if handler == nil {
+		handler = Echo
+	}
+
+	srv := &Server{
+		token:   token,
+		handler: handler,
+		specs:   defaultSpecs(),
+		kernels: make(map[uuid.UUID]*Kernel),
+	}
+
+	mux := chi.NewRouter()
+	mux.Use(srv.authenticate)
+	mux.Get("/api/kernelspecs", srv.listKernelSpecs)
+	mux.Get("/api/kernels", srv.listKernels)
+	mux.Post("/api/kernels", srv.createKernel)
+	mux.Get("/api/kernels/{id}", srv.getKernel)
+	mux.Delete("/api/kernels/{id}", srv.deleteKernel)
+	mux.Post("/api/kernels/{id}/interrupt", srv.interruptKernel)
+	mux.Get("/api/kernels/{id}/channels", srv.connectKernel)
+
+	srv.server = httptest.NewServer(mux)
+
+	return srv
+}
+
+// URL returns the base url of the server.
+func (srv *Server) URL() string {
+	return srv.server.URL
+}
+
+// Config returns the client configuration for the server.
+func (srv *Server) Config() jupyter.Config {
+	return jupyter.Config{
+		Address: srv.server.URL,
+		Token:   srv.token,
+	}
+}
+
+// Close shuts down the server and closes all kernel connections.
+func (srv *Server) Close() {
+	srv.mu.Lock()
+	for _, kernel := range srv.kernels {
+		kernel.close()
+	}
+	srv.mu.Unlock()
+
+	srv.server.CloseClientConnections()
+	srv.server.Close()
+}
+
+// SetHandler sets the handler of the kernels created afterwards.
+func (srv *Server) SetHandler(handler Handler) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.handler = handler
+}
+
+// SetIntrospection sets the introspection of the kernels created afterwards.
+func (srv *Server) SetIntrospection(intro Introspection) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.intro = intro
+}
+
+// FailCreate makes the next n kernel creation requests fail.
+func (srv *Server) FailCreate(n int) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.failures = n
+}
+
+// Created returns the total number of kernels created by the server.
+func (srv *Server) Created() int {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	return srv.created
+}
+
+// Kernel returns the kernel with the given identifier, or nil if it does not
+// exist.
+func (srv *Server) Kernel(id uuid.UUID) *Kernel {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	return srv.kernels[id]
+}
+
+// Kernels returns the running kernels sorted by identifier.
+func (srv *Server) Kernels() []*Kernel {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	kernels := make([]*Kernel, 0, len(srv.kernels))
+	for _, kernel := range srv.kernels {
+		kernels = append(kernels, kernel)
+	}
+	sort.Slice(kernels, func(i, j int) bool {
+		return kernels[i].ID.String() < kernels[j].ID.String()
+	})
+	return kernels
+}
+
+// Kill removes the kernel with the given identifier as if it died, dropping
+// its connections.
+func (srv *Server) Kill(id uuid.UUID) {
+	srv.mu.Lock()
+	kernel, ok := srv.kernels[id]
+	delete(srv.kernels, id)
+	srv.mu.Unlock()
+
+	if ok {
+		kernel.close()
+	}
+}
+
+func (srv *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		token := req.URL.Query().Get("token")
+		if auth := req.Header.Get("Authorization"); auth != "" {
+			token = strings.TrimPrefix(auth, "token ")
+		}
+		if srv.token != "" && token != srv.token {
+			writeError(res, http.StatusForbidden, "Forbidden")
+			return
+		}
+		next.ServeHTTP(res, req)
+	})
+}
+
+func (srv *Server) listKernels(res http.ResponseWriter, _ *http.Request) {
+	kernels := srv.Kernels()
+
+	models := make([]kernelModel, len(kernels))
+	for i, kernel := range kernels {
+		models[i] = kernel.model()
+	}
+	writeJSON(res, http.StatusOK, models)
+}
+
+func (srv *Server) createKernel(res http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil {
+		writeError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	srv.mu.Lock()
+	spec, ok := srv.specs[body.Name]
+	if !ok {
+		srv.mu.Unlock()
+		writeError(res, http.StatusNotFound, "No such kernel named "+body.Name)
+		return
+	}
+	if srv.failures > 0 {
+		srv.failures--
+		srv.mu.Unlock()
+		writeError(res, http.StatusInternalServerError, "Failed to start kernel")
+		return
+	}
+	kernel := newKernel(spec, srv.handler, srv.intro)
+	srv.kernels[kernel.ID] = kernel
+	srv.created++
+	srv.mu.Unlock()
+
+	writeJSON(res, http.StatusCreated, kernel.model())
+}
+
+func (srv *Server) getKernel(res http.ResponseWriter, req *http.Request) {
+	kernel := srv.lookup(req)
+	if kernel == nil {
+		writeError(res, http.StatusNotFound, "Kernel does not exist")
+		return
+	}
+	writeJSON(res, http.StatusOK, kernel.model())
+}
+
+func (srv *Server) deleteKernel(res http.ResponseWriter, req *http.Request) {
+	kernel := srv.lookup(req)
+	if kernel == nil {
+		writeError(res, http.StatusNotFound, "Kernel does not exist")
+		return
+	}
+	srv.Kill(kernel.ID)
+	res.WriteHeader(http.StatusNoContent)
+}
+
+func (srv *Server) interruptKernel(res http.ResponseWriter, req *http.Request) {
+	kernel := srv.lookup(req)
+	if kernel == nil {
+		writeError(res, http.StatusNotFound, "Kernel does not exist")
+		return
+	}
+	kernel.interrupt()
+	res.WriteHeader(http.StatusNoContent)
+}
+
+func (srv *Server) connectKernel(res http.ResponseWriter, req *http.Request) {
+	kernel := srv.lookup(req)
+	if kernel == nil {
+		writeError(res, http.StatusNotFound, "Kernel does not exist")
+		return
+	}
+	websocket.Server{Handler: kernel.serve}.ServeHTTP(res, req)
+}
+
+func (srv *Server) lookup(req *http.Request) *Kernel {
+	id, err := uuid.Parse(chi.URLParam(req, "id"))
+	if err != nil {
+		return nil
+	}
+	return srv.Kernel(id)
+}
+
+func writeJSON(res http.ResponseWriter, code int, value any) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(code)
+	_ = json.NewEncoder(res).Encode(value)
+}
+
+func writeError(res http.ResponseWriter, code int, message string) {
+	writeJSON(res, code, jupyter.Error{Message: message})
+}
@@ -1,12 +1,14 @@
 package jupyter
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
 	"net/url"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"golang.org/x/net/websocket"
@@ -19,10 +21,22 @@ type Kernel struct {
 	Address net.Addr  `json:"-"`
 	ChanURL string    `json:"-"`
 
+	// InterruptMode is the interrupt mode of the kernel spec. Kernels that do
+	// not use InterruptModeMessage are interrupted by the jupyter server.
+	InterruptMode string `json:"-"`
+
+	client *Client
+
 	mu   sync.RWMutex
 	conn *websocket.Conn
 }
 
+// Interrupt modes of the kernel specs.
+const (
+	InterruptModeSignal  = "signal"
+	InterruptModeMessage = "message"
+)
+
 // Connect establishes a connection to the jupyter kernel.
 func (k *Kernel) Connect() error {
 	k.mu.Lock()
@@ -58,14 +72,130 @@ var ErrNotConnected = errors.New("not connected")
 
 // Execute executes the given code in the jupyter kernel.
 func (k *Kernel) Execute(id uuid.UUID, code string) error {
+	return k.ExecuteRequest(id, MessageExecuteRequestContent{
+		Code: code,
+	}, nil)
+}
+
+// ExecuteRequest sends the execute request with the given content and
+// metadata to the jupyter kernel.
+func (k *Kernel) ExecuteRequest(id uuid.UUID, content MessageExecuteRequestContent, metadata MetaData) error {
+	if content.UserExpressions == nil {
+		// Kernels expect a mapping, even an empty one.
+		content.UserExpressions = map[string]string{}
+	}
+	if metadata == nil {
+		metadata = MetaData{}
+	}
+
 	return k.WriteMessage(&MessageExecuteRequest{
 		Header: Header{
 			MsgID:   id.String(),
 			MsgType: MsgTypeExecuteRequest,
 		},
-		Content: MessageExecuteRequestContent{
+		MetaData: metadata,
+		Content:  content,
+	})
+}
+
+// Complete sends the completion request of the code at the given cursor
+// position to the jupyter kernel.
+func (k *Kernel) Complete(id uuid.UUID, code string, cursor int) error {
+	return k.WriteMessage(&MessageCompleteRequest{
+		Header: Header{
+			MsgID:   id.String(),
+			MsgType: MsgTypeCompleteRequest,
+		},
+		MetaData: MetaData{},
+		Content: MessageCompleteRequestContent{
+			Code:      code,
+			CursorPos: cursor,
+		},
+		Channel: ChannelShell,
+	})
+}
+
+// Inspect sends the introspection request of the code at the given cursor
+// position to the jupyter kernel.
+func (k *Kernel) Inspect(id uuid.UUID, code string, cursor, detail int) error {
+	return k.WriteMessage(&MessageInspectRequest{
+		Header: Header{
+			MsgID:   id.String(),
+			MsgType: MsgTypeInspectRequest,
+		},
+		MetaData: MetaData{},
+		Content: MessageInspectRequestContent{
+			Code:        code,
+			CursorPos:   cursor,
+			DetailLevel: detail,
+		},
+		Channel: ChannelShell,
+	})
+}
+
+// IsComplete sends the request of the code completeness check to the jupyter
+// kernel.
+func (k *Kernel) IsComplete(id uuid.UUID, code string) error {
+	return k.WriteMessage(&MessageIsCompleteRequest{
+		Header: Header{
+			MsgID:   id.String(),
+			MsgType: MsgTypeIsCompleteRequest,
+		},
+		MetaData: MetaData{},
+		Content: MessageIsCompleteRequestContent{
 			Code: code,
 		},
+		Channel: ChannelShell,
+	})
+}
+
+// KernelInfo sends the kernel info request to the jupyter kernel.
+func (k *Kernel) KernelInfo(id uuid.UUID) error {
+	return k.WriteMessage(&MessageKernelInfoRequest{
+		Header: Header{
+			MsgID:   id.String(),
+			MsgType: MsgTypeKernelInfoRequest,
+		},
+		MetaData: MetaData{},
+		Content:  map[string]any{},
+		Channel:  ChannelShell,
+	})
+}
+
+// Input sends the given value to the jupyter kernel in reply to the input
+// request with the given header.
+func (k *Kernel) Input(parent Header, value string) error {
+	return k.WriteMessage(&MessageInputReply{
+		Header: Header{
+			MsgID:   uuid.New().String(),
+			MsgType: MsgTypeInputReply,
+		},
+		ParentHeader: ParentHeader{
+			MsgID:   parent.MsgID,
+			MsgType: parent.MsgType,
+		},
+		Content: MessageInputReplyContent{
+			Value: value,
+		},
+		Channel: ChannelStdin,
+	})
+}
+
+// Interrupt interrupts the execution of the jupyter kernel. Kernels in the
+// message mode receive an interrupt request over the control channel, others
+// are interrupted by the jupyter server, which signals the kernel process.
+func (k *Kernel) Interrupt(ctx context.Context) error {
+	if k.InterruptMode != InterruptModeMessage && k.client != nil {
+		return k.client.InterruptKernel(ctx, k)
+	}
+
+	return k.WriteMessage(&MessageInterruptRequest{
+		Header: Header{
+			MsgID:   uuid.New().String(),
+			MsgType: MsgTypeInterruptRequest,
+		},
+		Content: MessageInterruptRequestContent{},
+		Channel: ChannelControl,
 	})
 }
 
@@ -136,6 +266,62 @@ func (k *Kernel) ReadMessage() (Message, error) {
 			return nil, fmt.Errorf("failed to decode: %w", err)
 		}
 		return msg, nil
+	case MsgTypeUpdateDisplayData:
+		msg := new(MessageUpdateDisplayData)
+		err = json.Unmarshal(buf, msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode: %w", err)
+		}
+		return msg, nil
+	case MsgTypeExecuteResult:
+		msg := new(MessageExecuteResult)
+		err = json.Unmarshal(buf, msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode: %w", err)
+		}
+		return msg, nil
+	case MsgTypeClearOutput:
+		msg := new(MessageClearOutput)
+		err = json.Unmarshal(buf, msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode: %w", err)
+		}
+		return msg, nil
+	case MsgTypeInputRequest:
+		msg := new(MessageInputRequest)
+		err = json.Unmarshal(buf, msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode: %w", err)
+		}
+		return msg, nil
+	case MsgTypeCompleteReply:
+		msg := new(MessageCompleteReply)
+		err = json.Unmarshal(buf, msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode: %w", err)
+		}
+		return msg, nil
+	case MsgTypeInspectReply:
+		msg := new(MessageInspectReply)
+		err = json.Unmarshal(buf, msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode: %w", err)
+		}
+		return msg, nil
+	case MsgTypeIsCompleteReply:
+		msg := new(MessageIsCompleteReply)
+		err = json.Unmarshal(buf, msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode: %w", err)
+		}
+		return msg, nil
+	case MsgTypeKernelInfoReply:
+		msg := new(MessageKernelInfoReply)
+		err = json.Unmarshal(buf, msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode: %w", err)
+		}
+		return msg, nil
 	default:
 		return base, nil
 	}
@@ -158,6 +344,23 @@ func (k *Kernel) WriteMessage(msg Message) error {
 	return nil
 }
 
+// SetReadDeadline sets the deadline for future and currently blocked reads
+// from the kernel. A zero value means reads will not time out.
+func (k *Kernel) SetReadDeadline(t time.Time) error {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.conn == nil {
+		return ErrNotConnected
+	}
+
+	err := k.conn.SetReadDeadline(t)
+	if err != nil {
+		return fmt.Errorf("failed to set deadline: %w", err)
+	}
+	return nil
+}
+
 // Close closes the connection to the jupyter kernel.
 func (k *Kernel) Close() error {
 	k.mu.Lock()
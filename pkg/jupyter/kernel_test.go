@@ -0,0 +1,228 @@
+package jupyter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/uclatall/ckhub/pkg/jupyter"
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+)
+
+func connectKernel(t *testing.T, srv *jupytertest.Server) *jupyter.Kernel {
+	t.Helper()
+
+	kernel, err := newClient(t, srv).CreateKernel(context.Background(), "python3")
+	if err != nil {
+		t.Fatalf("failed to create kernel: %v", err)
+	}
+	err = kernel.Connect()
+	if err != nil {
+		t.Fatalf("failed to connect kernel: %v", err)
+	}
+	t.Cleanup(func() { _ = kernel.Close() })
+
+	err = kernel.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+	return kernel
+}
+
+// readUntilIdle reads messages of the given execution until the kernel
+// becomes idle.
+func readUntilIdle(t *testing.T, kernel *jupyter.Kernel, id uuid.UUID) []jupyter.Message {
+	t.Helper()
+
+	var msgs []jupyter.Message
+	for {
+		msg, err := kernel.ReadMessage()
+		if err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		if !msg.IsChildByParentMsgID(id.String()) {
+			continue
+		}
+		msgs = append(msgs, msg)
+
+		status, ok := msg.(*jupyter.MessageStatus)
+		if ok && status.Content.ExecutionState == jupyter.StateIdle {
+			return msgs
+		}
+	}
+}
+
+func TestKernelReadMessage(t *testing.T) {
+	srv := jupytertest.NewServer("secret", func(code string) jupytertest.Reply {
+		return jupytertest.Reply{
+			Outputs: []jupytertest.Output{
+				jupytertest.Stream("stdout", code),
+				jupytertest.DisplayData("plot", map[string]any{"text/plain": "<plot>"}),
+				jupytertest.UpdateDisplayData("plot", map[string]any{"text/plain": "<plot 2>"}),
+				jupytertest.ExecuteResult(map[string]any{"text/plain": "42"}),
+				jupytertest.ClearOutput(true),
+				jupytertest.Error("ValueError", "boom"),
+			},
+			Status: "error",
+		}
+	})
+	defer srv.Close()
+
+	kernel := connectKernel(t, srv)
+
+	id := uuid.New()
+	err := kernel.Execute(id, "print(42)")
+	if err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+
+	msgs := readUntilIdle(t, kernel, id)
+
+	expected := []jupyter.MsgType{
+		jupyter.MsgTypeStatus,
+		jupyter.MsgTypeStream,
+		jupyter.MsgTypeDisplayData,
+		jupyter.MsgTypeUpdateDisplayData,
+		jupyter.MsgTypeExecuteResult,
+		jupyter.MsgTypeClearOutput,
+		jupyter.MsgTypeError,
+		jupyter.MsgTypeExecuteReply,
+		jupyter.MsgTypeStatus,
+	}
+	if len(msgs) != len(expected) {
+		t.Fatalf("unexpected number of messages: %d", len(msgs))
+	}
+	for i, msg := range msgs {
+		if msg.GetMsgType() != expected[i] {
+			t.Errorf("unexpected type of message %d: %s", i, msg.GetMsgType())
+		}
+	}
+
+	stream, ok := msgs[1].(*jupyter.MessageStream)
+	if !ok || stream.Content.Text != "print(42)" {
+		t.Errorf("unexpected stream message: %#v", msgs[1])
+	}
+	display, ok := msgs[2].(*jupyter.MessageDisplayData)
+	if !ok || display.Content.Transient.DisplayID != "plot" {
+		t.Errorf("unexpected display data message: %#v", msgs[2])
+	}
+	reply, ok := msgs[7].(*jupyter.MessageExecuteReply)
+	if !ok || reply.Content.Status != "error" || reply.Content.ExecutionCount != 1 {
+		t.Errorf("unexpected execute reply message: %#v", msgs[7])
+	}
+}
+
+func TestKernelInput(t *testing.T) {
+	srv := jupytertest.NewServer("", func(string) jupytertest.Reply {
+		return jupytertest.Reply{
+			Outputs: []jupytertest.Output{jupytertest.InputRequest("name: ")},
+		}
+	})
+	defer srv.Close()
+
+	kernel := connectKernel(t, srv)
+
+	id := uuid.New()
+	err := kernel.Execute(id, "input('name: ')")
+	if err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+
+	var text string
+	for text == "" {
+		msg, err := kernel.ReadMessage()
+		if err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		switch msg := msg.(type) {
+		case *jupyter.MessageInputRequest:
+			if msg.Content.Prompt != "name: " {
+				t.Errorf("unexpected prompt: %q", msg.Content.Prompt)
+			}
+			err = kernel.Input(msg.Header, "ckhub")
+			if err != nil {
+				t.Fatalf("failed to send input: %v", err)
+			}
+		case *jupyter.MessageStream:
+			text = msg.Content.Text
+		}
+	}
+	if text != "ckhub" {
+		t.Errorf("unexpected echoed input: %q", text)
+	}
+}
+
+func TestKernelInterrupt(t *testing.T) {
+	for _, mode := range []string{jupyter.InterruptModeSignal, jupyter.InterruptModeMessage} {
+		t.Run(mode, func(t *testing.T) {
+			srv := jupytertest.NewServer("", func(string) jupytertest.Reply {
+				return jupytertest.Reply{Hang: true}
+			})
+			defer srv.Close()
+
+			spec := jupytertest.KernelSpec("python3", "python")
+			spec.Spec.InterruptMode = mode
+			srv.SetKernelSpecs(spec)
+
+			kernel := connectKernel(t, srv)
+			kernel.InterruptMode = mode
+
+			id := uuid.New()
+			err := kernel.Execute(id, "while True: pass")
+			if err != nil {
+				t.Fatalf("failed to execute: %v", err)
+			}
+			err = kernel.Interrupt(context.Background())
+			if err != nil {
+				t.Fatalf("failed to interrupt: %v", err)
+			}
+
+			msgs := readUntilIdle(t, kernel, id)
+
+			var ename string
+			for _, msg := range msgs {
+				if msg, ok := msg.(*jupyter.MessageError); ok {
+					ename = msg.Content.EName
+				}
+			}
+			if ename != "KeyboardInterrupt" {
+				t.Errorf("unexpected error after interrupt: %q", ename)
+			}
+			if n := srv.Kernels()[0].Interrupts(); n != 1 {
+				t.Errorf("unexpected number of interrupts: %d", n)
+			}
+		})
+	}
+}
+
+func TestKernelInfo(t *testing.T) {
+	srv := jupytertest.NewServer("", nil)
+	defer srv.Close()
+
+	kernel := connectKernel(t, srv)
+
+	id := uuid.New()
+	err := kernel.KernelInfo(id)
+	if err != nil {
+		t.Fatalf("failed to request kernel info: %v", err)
+	}
+
+	for {
+		msg, err := kernel.ReadMessage()
+		if err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		reply, ok := msg.(*jupyter.MessageKernelInfoReply)
+		if !ok || !reply.IsChildByParentMsgID(id.String()) {
+			continue
+		}
+
+		info := reply.Content.LanguageInfo
+		if info.Name != "python" || info.FileExtension != ".py" || info.Version == "" {
+			t.Errorf("unexpected language info: %+v", info)
+		}
+		return
+	}
+}
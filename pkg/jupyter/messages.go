@@ -62,7 +62,18 @@ type MessageDisplayData struct {
 // MessageDisplayDataContent contains the structure
 // of the MsgTypeDisplayData message content.
 type MessageDisplayDataContent struct {
-	Data map[string]string `json:"data"`
+	// The data dict contains key/value pairs, where the keys are MIME
+	// types and the values are the raw data of the representation
+	Data map[string]any `json:"data"`
+	// Any metadata that describes the data
+	MetaData MetaData `json:"metadata"`
+	// Information not to be persisted to a notebook or other documents
+	Transient Transient `json:"transient"`
+}
+
+// Transient contains the structure of the transient message data.
+type Transient struct {
+	DisplayID string `json:"display_id,omitempty"`
 }
 
 // GetMsgType returns header of the message
@@ -77,6 +88,91 @@ func (m MessageDisplayData) IsChildByParentMsgID(u string) bool {
 	return parentMsgID == m.ParentHeader.MsgID
 }
 
+// MessageUpdateDisplayData contains details about a jupyter message
+// for MsgTypeUpdateDisplayData.
+type MessageUpdateDisplayData struct {
+	Header       Header                    `json:"header"`
+	ParentHeader ParentHeader              `json:"parent_header"`
+	MetaData     MetaData                  `json:"metadata"`
+	Content      MessageDisplayDataContent `json:"content"`
+	Channel      Channel                   `json:"channel"`
+}
+
+// GetMsgType returns header of the message
+func (m MessageUpdateDisplayData) GetMsgType() MsgType {
+	return m.Header.MsgType
+}
+
+// IsChildByParentMsgID determines whether the message
+// is child of given message ID or not
+func (m MessageUpdateDisplayData) IsChildByParentMsgID(u string) bool {
+	parentMsgID := u
+	return parentMsgID == m.ParentHeader.MsgID
+}
+
+// MessageExecuteResult contains details about a jupyter message
+// for MsgTypeExecuteResult.
+type MessageExecuteResult struct {
+	Header       Header                      `json:"header"`
+	ParentHeader ParentHeader                `json:"parent_header"`
+	MetaData     MetaData                    `json:"metadata"`
+	Content      MessageExecuteResultContent `json:"content"`
+	Channel      Channel                     `json:"channel"`
+}
+
+// MessageExecuteResultContent contains the structure
+// of the MsgTypeExecuteResult message content.
+type MessageExecuteResultContent struct {
+	// The counter for this execution
+	ExecutionCount int `json:"execution_count"`
+	// The data dict contains key/value pairs, where the keys are MIME
+	// types and the values are the raw data of the representation
+	Data map[string]any `json:"data"`
+	// Any metadata that describes the data
+	MetaData MetaData `json:"metadata"`
+}
+
+// GetMsgType returns header of the message
+func (m MessageExecuteResult) GetMsgType() MsgType {
+	return m.Header.MsgType
+}
+
+// IsChildByParentMsgID determines whether the message
+// is child of given message ID or not
+func (m MessageExecuteResult) IsChildByParentMsgID(u string) bool {
+	parentMsgID := u
+	return parentMsgID == m.ParentHeader.MsgID
+}
+
+// MessageClearOutput contains details about a jupyter message
+// for MsgTypeClearOutput.
+type MessageClearOutput struct {
+	Header       Header                    `json:"header"`
+	ParentHeader ParentHeader              `json:"parent_header"`
+	MetaData     MetaData                  `json:"metadata"`
+	Content      MessageClearOutputContent `json:"content"`
+	Channel      Channel                   `json:"channel"`
+}
+
+// MessageClearOutputContent contains the structure
+// of the MsgTypeClearOutput message content.
+type MessageClearOutputContent struct {
+	// Wait to clear the output until new output is available
+	Wait bool `json:"wait"`
+}
+
+// GetMsgType returns header of the message
+func (m MessageClearOutput) GetMsgType() MsgType {
+	return m.Header.MsgType
+}
+
+// IsChildByParentMsgID determines whether the message
+// is child of given message ID or not
+func (m MessageClearOutput) IsChildByParentMsgID(u string) bool {
+	parentMsgID := u
+	return parentMsgID == m.ParentHeader.MsgID
+}
+
 // MessageExecuteRequest contains details about a jupyter message
 // for MsgTypeExecuteRequest.
 type MessageExecuteRequest struct {
@@ -104,9 +200,8 @@ type MessageExecuteRequestContent struct {
 	// Whether to the abort execution queue on an error
 	// The default is `false`
 	StopOnError bool `json:"stop_on_error"`
-
 	// A mapping of names to expressions to be evaluated.
-	// UserExpressions json `json:"user_expressions"`
+	UserExpressions map[string]string `json:"user_expressions"`
 }
 
 // GetMsgType returns header of the message
@@ -121,6 +216,364 @@ func (m MessageExecuteRequest) IsChildByParentMsgID(u string) bool {
 	return parentMsgID == m.ParentHeader.MsgID
 }
 
+// MessageInputRequest contains details about a jupyter message
+// for MsgTypeInputRequest.
+type MessageInputRequest struct {
+	Header       Header                     `json:"header"`
+	ParentHeader ParentHeader               `json:"parent_header"`
+	MetaData     MetaData                   `json:"metadata"`
+	Content      MessageInputRequestContent `json:"content"`
+	Channel      Channel                    `json:"channel"`
+}
+
+// MessageInputRequestContent contains the structure
+// of the MsgTypeInputRequest message content.
+type MessageInputRequestContent struct {
+	// The text to show at the prompt
+	Prompt string `json:"prompt"`
+	// Whether the input is a password and should not be echoed
+	Password bool `json:"password"`
+}
+
+// GetMsgType returns header of the message
+func (m MessageInputRequest) GetMsgType() MsgType {
+	return m.Header.MsgType
+}
+
+// IsChildByParentMsgID determines whether the message
+// is child of given message ID or not
+func (m MessageInputRequest) IsChildByParentMsgID(u string) bool {
+	parentMsgID := u
+	return parentMsgID == m.ParentHeader.MsgID
+}
+
+// MessageInputReply contains details about a jupyter message
+// for MsgTypeInputReply.
+type MessageInputReply struct {
+	Header       Header                   `json:"header"`
+	ParentHeader ParentHeader             `json:"parent_header"`
+	MetaData     MetaData                 `json:"metadata"`
+	Content      MessageInputReplyContent `json:"content"`
+	Channel      Channel                  `json:"channel"`
+}
+
+// MessageInputReplyContent contains the structure
+// of the MsgTypeInputReply message content.
+type MessageInputReplyContent struct {
+	Value string `json:"value"`
+}
+
+// GetMsgType returns header of the message
+func (m MessageInputReply) GetMsgType() MsgType {
+	return m.Header.MsgType
+}
+
+// IsChildByParentMsgID determines whether the message
+// is child of given message ID or not
+func (m MessageInputReply) IsChildByParentMsgID(u string) bool {
+	parentMsgID := u
+	return parentMsgID == m.ParentHeader.MsgID
+}
+
+// MessageInterruptRequest contains details about a jupyter message
+// for MsgTypeInterruptRequest.
+type MessageInterruptRequest struct {
+	Header       Header                         `json:"header"`
+	ParentHeader ParentHeader                   `json:"parent_header"`
+	MetaData     MetaData                       `json:"metadata"`
+	Content      MessageInterruptRequestContent `json:"content"`
+	Channel      Channel                        `json:"channel"`
+}
+
+// MessageInterruptRequestContent contains the structure
+// of the MsgTypeInterruptRequest message content.
+type MessageInterruptRequestContent struct{}
+
+// GetMsgType returns header of the message
+func (m MessageInterruptRequest) GetMsgType() MsgType {
+	return m.Header.MsgType
+}
+
+// IsChildByParentMsgID determines whether the message
+// is child of given message ID or not
+func (m MessageInterruptRequest) IsChildByParentMsgID(u string) bool {
+	parentMsgID := u
+	return parentMsgID == m.ParentHeader.MsgID
+}
+
+// MessageCompleteRequest contains details about a jupyter message
+// for MsgTypeCompleteRequest.
+type MessageCompleteRequest struct {
+	Header       Header                        `json:"header"`
+	ParentHeader ParentHeader                  `json:"parent_header"`
+	MetaData     MetaData                      `json:"metadata"`
+	Content      MessageCompleteRequestContent `json:"content"`
+	Channel      Channel                       `json:"channel"`
+}
+
+// MessageCompleteRequestContent contains the structure
+// of the MsgTypeCompleteRequest message content.
+type MessageCompleteRequestContent struct {
+	// The code context in which completion is requested
+	Code string `json:"code"`
+	// The cursor position within the code, in unicode characters
+	CursorPos int `json:"cursor_pos"`
+}
+
+// GetMsgType returns header of the message
+func (m MessageCompleteRequest) GetMsgType() MsgType {
+	return m.Header.MsgType
+}
+
+// IsChildByParentMsgID determines whether the message
+// is child of given message ID or not
+func (m MessageCompleteRequest) IsChildByParentMsgID(u string) bool {
+	parentMsgID := u
+	return parentMsgID == m.ParentHeader.MsgID
+}
+
+// MessageCompleteReply contains details about a jupyter message
+// for MsgTypeCompleteReply.
+type MessageCompleteReply struct {
+	Header       Header                      `json:"header"`
+	ParentHeader ParentHeader                `json:"parent_header"`
+	MetaData     MetaData                    `json:"metadata"`
+	Content      MessageCompleteReplyContent `json:"content"`
+	Channel      Channel                     `json:"channel"`
+}
+
+// MessageCompleteReplyContent contains the structure
+// of the MsgTypeCompleteReply message content.
+type MessageCompleteReplyContent struct {
+	Status string `json:"status"`
+	// The list of all matches to the completion request
+	Matches []string `json:"matches"`
+	// The range of the text that should be replaced by the match
+	CursorStart int `json:"cursor_start"`
+	CursorEnd   int `json:"cursor_end"`
+	// Information that frontend plugins might use for extra display
+	MetaData MetaData `json:"metadata"`
+}
+
+// GetMsgType returns header of the message
+func (m MessageCompleteReply) GetMsgType() MsgType {
+	return m.Header.MsgType
+}
+
+// IsChildByParentMsgID determines whether the message
+// is child of given message ID or not
+func (m MessageCompleteReply) IsChildByParentMsgID(u string) bool {
+	parentMsgID := u
+	return parentMsgID == m.ParentHeader.MsgID
+}
+
+// MessageInspectRequest contains details about a jupyter message
+// for MsgTypeInspectRequest.
+type MessageInspectRequest struct {
+	Header       Header                       `json:"header"`
+	ParentHeader ParentHeader                 `json:"parent_header"`
+	MetaData     MetaData                     `json:"metadata"`
+	Content      MessageInspectRequestContent `json:"content"`
+	Channel      Channel                      `json:"channel"`
+}
+
+// MessageInspectRequestContent contains the structure
+// of the MsgTypeInspectRequest message content.
+type MessageInspectRequestContent struct {
+	// The code context in which introspection is requested
+	Code string `json:"code"`
+	// The cursor position within the code, in unicode characters
+	CursorPos int `json:"cursor_pos"`
+	// The level of detail desired, 0 or 1
+	DetailLevel int `json:"detail_level"`
+}
+
+// GetMsgType returns header of the message
+func (m MessageInspectRequest) GetMsgType() MsgType {
+	return m.Header.MsgType
+}
+
+// IsChildByParentMsgID determines whether the message
+// is child of given message ID or not
+func (m MessageInspectRequest) IsChildByParentMsgID(u string) bool {
+	parentMsgID := u
+	return parentMsgID == m.ParentHeader.MsgID
+}
+
+// MessageInspectReply contains details about a jupyter message
+// for MsgTypeInspectReply.
+type MessageInspectReply struct {
+	Header       Header                     `json:"header"`
+	ParentHeader ParentHeader               `json:"parent_header"`
+	MetaData     MetaData                   `json:"metadata"`
+	Content      MessageInspectReplyContent `json:"content"`
+	Channel      Channel                    `json:"channel"`
+}
+
+// MessageInspectReplyContent contains the structure
+// of the MsgTypeInspectReply message content.
+type MessageInspectReplyContent struct {
+	Status string `json:"status"`
+	// Whether the object was found or not
+	Found bool `json:"found"`
+	// The data dict contains key/value pairs, where the keys are MIME
+	// types and the values are the raw data of the representation
+	Data map[string]any `json:"data"`
+	// Any metadata that describes the data
+	MetaData MetaData `json:"metadata"`
+}
+
+// GetMsgType returns header of the message
+func (m MessageInspectReply) GetMsgType() MsgType {
+	return m.Header.MsgType
+}
+
+// IsChildByParentMsgID determines whether the message
+// is child of given message ID or not
+func (m MessageInspectReply) IsChildByParentMsgID(u string) bool {
+	parentMsgID := u
+	return parentMsgID == m.ParentHeader.MsgID
+}
+
+// MessageIsCompleteRequest contains details about a jupyter message
+// for MsgTypeIsCompleteRequest.
+type MessageIsCompleteRequest struct {
+	Header       Header                          `json:"header"`
+	ParentHeader ParentHeader                    `json:"parent_header"`
+	MetaData     MetaData                        `json:"metadata"`
+	Content      MessageIsCompleteRequestContent `json:"content"`
+	Channel      Channel                         `json:"channel"`
+}
+
+// MessageIsCompleteRequestContent contains the structure
+// of the MsgTypeIsCompleteRequest message content.
+type MessageIsCompleteRequestContent struct {
+	// The code entered so far as a multiline string
+	Code string `json:"code"`
+}
+
+// GetMsgType returns header of the message
+func (m MessageIsCompleteRequest) GetMsgType() MsgType {
+	return m.Header.MsgType
+}
+
+// IsChildByParentMsgID determines whether the message
+// is child of given message ID or not
+func (m MessageIsCompleteRequest) IsChildByParentMsgID(u string) bool {
+	parentMsgID := u
+	return parentMsgID == m.ParentHeader.MsgID
+}
+
+// MessageIsCompleteReply contains details about a jupyter message
+// for MsgTypeIsCompleteReply.
+type MessageIsCompleteReply struct {
+	Header       Header                        `json:"header"`
+	ParentHeader ParentHeader                  `json:"parent_header"`
+	MetaData     MetaData                      `json:"metadata"`
+	Content      MessageIsCompleteReplyContent `json:"content"`
+	Channel      Channel                       `json:"channel"`
+}
+
+// MessageIsCompleteReplyContent contains the structure
+// of the MsgTypeIsCompleteReply message content.
+type MessageIsCompleteReplyContent struct {
+	// One of "complete", "incomplete", "invalid", "unknown"
+	Status string `json:"status"`
+	// The indentation of the next line, if the code is incomplete
+	Indent string `json:"indent,omitempty"`
+}
+
+// GetMsgType returns header of the message
+func (m MessageIsCompleteReply) GetMsgType() MsgType {
+	return m.Header.MsgType
+}
+
+// IsChildByParentMsgID determines whether the message
+// is child of given message ID or not
+func (m MessageIsCompleteReply) IsChildByParentMsgID(u string) bool {
+	parentMsgID := u
+	return parentMsgID == m.ParentHeader.MsgID
+}
+
+// MessageKernelInfoRequest contains details about a jupyter message
+// for MsgTypeKernelInfoRequest.
+type MessageKernelInfoRequest struct {
+	Header       Header         `json:"header"`
+	ParentHeader ParentHeader   `json:"parent_header"`
+	MetaData     MetaData       `json:"metadata"`
+	Content      map[string]any `json:"content"`
+	Channel      Channel        `json:"channel"`
+}
+
+// GetMsgType returns header of the message
+func (m MessageKernelInfoRequest) GetMsgType() MsgType {
+	return m.Header.MsgType
+}
+
+// IsChildByParentMsgID determines whether the message
+// is child of given message ID or not
+func (m MessageKernelInfoRequest) IsChildByParentMsgID(u string) bool {
+	parentMsgID := u
+	return parentMsgID == m.ParentHeader.MsgID
+}
+
+// MessageKernelInfoReply contains details about a jupyter message
+// for MsgTypeKernelInfoReply.
+type MessageKernelInfoReply struct {
+	Header       Header                        `json:"header"`
+	ParentHeader ParentHeader                  `json:"parent_header"`
+	MetaData     MetaData                      `json:"metadata"`
+	Content      MessageKernelInfoReplyContent `json:"content"`
+	Channel      Channel                       `json:"channel"`
+}
+
+// MessageKernelInfoReplyContent contains the structure
+// of the MsgTypeKernelInfoReply message content.
+type MessageKernelInfoReplyContent struct {
+	Status string `json:"status"`
+	// Version of messaging protocol
+	ProtocolVersion string `json:"protocol_version"`
+	// The kernel implementation name and version
+	Implementation        string `json:"implementation"`
+	ImplementationVersion string `json:"implementation_version"`
+	// Information about the language of code for the kernel
+	LanguageInfo LanguageInfo `json:"language_info"`
+	// A banner of information about the kernel
+	Banner string `json:"banner"`
+}
+
+// LanguageInfo contains the language details of the jupyter kernel.
+type LanguageInfo struct {
+	// Name of the programming language that the kernel implements
+	Name string `json:"name"`
+	// Language version number
+	Version string `json:"version"`
+	// Mimetype for script files in this language
+	MimeType string `json:"mimetype"`
+	// Extension including the dot, e.g. '.py'
+	FileExtension string `json:"file_extension"`
+	// Pygments lexer, for highlighting
+	PygmentsLexer string `json:"pygments_lexer,omitempty"`
+	// Codemirror mode, for highlighting in the notebook, either a name or
+	// a mode specification
+	CodemirrorMode any `json:"codemirror_mode,omitempty"`
+	// Nbconvert exporter, if notebooks written with this kernel should be
+	// exported with something other than the general 'script' exporter
+	NbconvertExporter string `json:"nbconvert_exporter,omitempty"`
+}
+
+// GetMsgType returns header of the message
+func (m MessageKernelInfoReply) GetMsgType() MsgType {
+	return m.Header.MsgType
+}
+
+// IsChildByParentMsgID determines whether the message
+// is child of given message ID or not
+func (m MessageKernelInfoReply) IsChildByParentMsgID(u string) bool {
+	parentMsgID := u
+	return parentMsgID == m.ParentHeader.MsgID
+}
+
 // MessageStream contains details about a jupyter message
 // for MsgTypeStream.
 type MessageStream struct {
@@ -195,6 +648,19 @@ type MessageExecuteReply struct {
 type MessageExecuteReplyContent struct {
 	Status         string `json:"status"`
 	ExecutionCount int    `json:"execution_count"`
+	// Results of the user expressions evaluation.
+	UserExpressions map[string]UserExpression `json:"user_expressions,omitempty"`
+}
+
+// UserExpression contains the structure of the evaluated user expression.
+// Successful evaluations carry the data, and failed ones carry the error.
+type UserExpression struct {
+	Status    string         `json:"status"`
+	Data      map[string]any `json:"data,omitempty"`
+	MetaData  MetaData       `json:"metadata,omitempty"`
+	EName     string         `json:"ename,omitempty"`
+	EValue    string         `json:"evalue,omitempty"`
+	Traceback []string       `json:"traceback,omitempty"`
 }
 
 // GetMsgType returns header of the message
@@ -1,5 +1,7 @@
 package jupyter
 
+import "time"
+
 // Option is a generic interface of the jupyter configuration option.
 type Option interface {
 	// Apply applies the option to the given jupyter.
@@ -13,3 +15,16 @@ type OptionFunc func(client *Client) error
 func (o OptionFunc) Apply(client *Client) error {
 	return o(client)
 }
+
+// ObserverFunc is called after each request to the jupyter server with the
+// operation name, its duration, and the error if the request failed.
+type ObserverFunc func(operation string, duration time.Duration, err error)
+
+// Observer creates a new option that sets the observer of the jupyter server
+// requests.
+func Observer(observer ObserverFunc) OptionFunc {
+	return func(client *Client) error {
+		client.observer = observer
+		return nil
+	}
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a cumulative metric that only increases.
+type Counter struct {
+	bits uint64
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds the given non-negative value to the counter.
+func (c *Counter) Add(value float64) {
+	if value < 0 {
+		return
+	}
+	for {
+		old := atomic.LoadUint64(&c.bits)
+		next := math.Float64bits(math.Float64frombits(old) + value)
+		if atomic.CompareAndSwapUint64(&c.bits, old, next) {
+			return
+		}
+	}
+}
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&c.bits))
+}
+
+// CounterVec is a family of counters partitioned by label values.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.RWMutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	values  []string
+	counter Counter
+}
+
+// NewCounterVec creates a new counter family with the given label names.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		series: make(map[string]*counterSeries),
+	}
+}
+
+// With returns the counter for the given label values, creating it if
+// necessary. It panics if the number of values does not match the labels.
+func (v *CounterVec) With(values ...string) *Counter {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d labels", v.name, len(v.labels)))
+	}
+	key := seriesKey(values)
+
+	v.mu.RLock()
+	series, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return &series.counter
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	series, ok = v.series[key]
+	if !ok {
+		series = &counterSeries{values: append([]string(nil), values...)}
+		v.series[key] = series
+	}
+	return &series.counter
+}
+
+// Collect writes the counter family samples to the given writer.
+func (v *CounterVec) Collect(w *Writer) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	w.Header(v.name, v.help, "counter")
+	for _, key := range sortedKeys(v.series) {
+		series := v.series[key]
+		w.Sample(v.name, labels(v.labels, series.values), series.counter.Value())
+	}
+}
@@ -0,0 +1,3 @@
+// Package metrics provides a minimal set of metrics exposed in the prometheus
+// text format.
+package metrics
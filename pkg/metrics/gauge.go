@@ -0,0 +1,45 @@
+package metrics
+
+// GaugeFunc is a gauge family whose samples are collected on demand.
+type GaugeFunc struct {
+	name    string
+	help    string
+	labels  []string
+	collect func(observe func(value float64, values ...string))
+}
+
+// NewGaugeFunc creates a new gauge family with the given label names. The
+// given function is called on each collection, and reports current values of
+// the gauges with the observe callback.
+func NewGaugeFunc(
+	name, help string,
+	collect func(observe func(value float64, values ...string)),
+	labels ...string,
+) *GaugeFunc {
+	return &GaugeFunc{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		collect: collect,
+	}
+}
+
+// Collect writes the gauge family samples to the given writer.
+func (g *GaugeFunc) Collect(w *Writer) {
+	series := make(map[string]float64)
+	values := make(map[string][]string)
+
+	g.collect(func(value float64, labelValues ...string) {
+		if len(labelValues) != len(g.labels) {
+			return
+		}
+		key := seriesKey(labelValues)
+		series[key] = value
+		values[key] = labelValues
+	})
+
+	w.Header(g.name, g.help, "gauge")
+	for _, key := range sortedKeys(series) {
+		w.Sample(g.name, labels(g.labels, values[key]), series[key])
+	}
+}
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DefaultBuckets are the default histogram buckets, tailored to measure
+// latencies in seconds.
+var DefaultBuckets = []float64{
+	0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60,
+}
+
+// Histogram counts observations in configurable buckets.
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// Observe adds the given observation to the histogram.
+func (h *Histogram) Observe(value float64) {
+	i := sort.SearchFloat64s(h.buckets, value)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += value
+}
+
+// HistogramVec is a family of histograms partitioned by label values.
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.RWMutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	values    []string
+	histogram Histogram
+}
+
+// NewHistogramVec creates a new histogram family with the given buckets and
+// label names. If buckets are empty, the default ones are used.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+}
+
+// With returns the histogram for the given label values, creating it if
+// necessary. It panics if the number of values does not match the labels.
+func (v *HistogramVec) With(values ...string) *Histogram {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d labels", v.name, len(v.labels)))
+	}
+	key := seriesKey(values)
+
+	v.mu.RLock()
+	series, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return &series.histogram
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	series, ok = v.series[key]
+	if !ok {
+		series = &histogramSeries{
+			values: append([]string(nil), values...),
+			histogram: Histogram{
+				buckets: v.buckets,
+				counts:  make([]uint64, len(v.buckets)),
+			},
+		}
+		v.series[key] = series
+	}
+	return &series.histogram
+}
+
+// Collect writes the histogram family samples to the given writer.
+func (v *HistogramVec) Collect(w *Writer) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	w.Header(v.name, v.help, "histogram")
+	for _, key := range sortedKeys(v.series) {
+		series := v.series[key]
+		base := labels(v.labels, series.values)
+
+		h := &series.histogram
+		h.mu.Lock()
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += h.counts[i]
+			w.Sample(v.name+"_bucket", withLe(base, formatValue(bound)), float64(cumulative))
+		}
+		w.Sample(v.name+"_bucket", withLe(base, "+Inf"), float64(h.count))
+		w.Sample(v.name+"_sum", base, h.sum)
+		w.Sample(v.name+"_count", base, float64(h.count))
+		h.mu.Unlock()
+	}
+}
+
+func withLe(base []Label, le string) []Label {
+	result := make([]Label, len(base), len(base)+1)
+	copy(result, base)
+	return append(result, Label{Name: "le", Value: le})
+}
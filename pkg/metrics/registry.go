@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Collector is a generic interface of the metric family.
+type Collector interface {
+	// Collect writes the metric family samples to the given writer.
+	Collect(w *Writer)
+}
+
+// Registry is a collection of metrics.
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []Collector
+}
+
+// NewRegistry creates a new empty metrics registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register appends given collectors to the registry.
+func (r *Registry) Register(collectors ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.collectors = append(r.collectors, collectors...)
+}
+
+// WriteTo writes all registered metrics to the given writer in the prometheus
+// text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	writer := &Writer{w: bufio.NewWriter(w)}
+	for _, collector := range r.collectors {
+		collector.Collect(writer)
+	}
+	return writer.n, writer.flush()
+}
+
+// ContentType is a content type of the prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// ServeHTTP writes all registered metrics to the response.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	_ = req.Body.Close()
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = r.WriteTo(w)
+}
+
+// Writer writes metrics in the prometheus text format.
+type Writer struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+// Header writes the help and type lines of the metric family.
+func (w *Writer) Header(name, help, kind string) {
+	w.printf("# HELP %s %s\n", name, escapeHelp(help))
+	w.printf("# TYPE %s %s\n", name, kind)
+}
+
+// Sample writes a single sample of the metric.
+func (w *Writer) Sample(name string, labels []Label, value float64) {
+	w.printf("%s%s %s\n", name, formatLabels(labels), formatValue(value))
+}
+
+func (w *Writer) printf(format string, a ...any) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, a...)
+	w.n += int64(n)
+	w.err = err
+}
+
+func (w *Writer) flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+// Label represents a label of the metric sample.
+type Label struct {
+	Name  string
+	Value string
+}
+
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, label := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(label.Name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(label.Value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+// labels pairs given label names with values.
+func labels(names, values []string) []Label {
+	result := make([]Label, len(names))
+	for i, name := range names {
+		result[i] = Label{Name: name, Value: values[i]}
+	}
+	return result
+}
+
+// seriesKey returns a key that identifies label values of the series.
+func seriesKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// sortedKeys returns keys of the series map in the stable order.
+func sortedKeys[T any](series map[string]T) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
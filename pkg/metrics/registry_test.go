@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func collect(t *testing.T, collectors ...Collector) string {
+	t.Helper()
+
+	registry := NewRegistry()
+	registry.Register(collectors...)
+
+	var b strings.Builder
+	_, err := registry.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("failed to write metrics: %v", err)
+	}
+	return b.String()
+}
+
+func TestCounterAndGauge(t *testing.T) {
+	counter := NewCounterVec("test_total", "Total number of tests.", "kernel", "status")
+	counter.With("python", "ok").Inc()
+	counter.With("python", "ok").Add(2)
+	counter.With("ir", "error").Inc()
+	counter.With("ir", "error").Add(-1)
+
+	gauge := NewGaugeFunc("test_instances", "Number of instances.", func(observe func(float64, ...string)) {
+		observe(3, "python")
+		observe(1.5, "ir")
+		observe(7, "ir", "unexpected")
+	}, "kernel")
+
+	expected := `# HELP test_total Total number of tests.
+# TYPE test_total counter
+test_total{kernel="ir",status="error"} 1
+test_total{kernel="python",status="ok"} 3
+# HELP test_instances Number of instances.
+# TYPE test_instances gauge
+test_instances{kernel="ir"} 1.5
+test_instances{kernel="python"} 3
+`
+	if output := collect(t, counter, gauge); output != expected {
+		t.Errorf("unexpected output:\n%s", output)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	histogram := NewHistogramVec("test_seconds", "Duration of tests.", []float64{1, 0.1}, "kernel")
+	for _, value := range []float64{0.05, 0.1, 0.5, 5} {
+		histogram.With("python").Observe(value)
+	}
+
+	expected := `# HELP test_seconds Duration of tests.
+# TYPE test_seconds histogram
+test_seconds_bucket{kernel="python",le="0.1"} 2
+test_seconds_bucket{kernel="python",le="1"} 3
+test_seconds_bucket{kernel="python",le="+Inf"} 4
+test_seconds_sum{kernel="python"} 5.65
+test_seconds_count{kernel="python"} 4
+`
+	if output := collect(t, histogram); output != expected {
+		t.Errorf("unexpected output:\n%s", output)
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	counter := NewCounterVec("test_total", "Help with \\ and\nnew line.", "name")
+	counter.With("a \"quoted\" \\ value\n").Inc()
+
+	expected := `# HELP test_total Help with \\ and\nnew line.
+# TYPE test_total counter
+test_total{name="a \"quoted\" \\ value\n"} 1
+`
+	if output := collect(t, counter); output != expected {
+		t.Errorf("unexpected output:\n%s", output)
+	}
+}
+
+func TestRegistryServeHTTP(t *testing.T) {
+	counter := NewCounterVec("test_total", "Total number of tests.")
+	counter.With().Inc()
+
+	registry := NewRegistry()
+	registry.Register(counter)
+
+	res := httptest.NewRecorder()
+	registry.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if res.Code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", res.Code)
+	}
+	if contentType := res.Header().Get("Content-Type"); contentType != ContentType {
+		t.Errorf("unexpected content type: %q", contentType)
+	}
+	if !strings.Contains(res.Body.String(), "\ntest_total 1\n") {
+		t.Errorf("unexpected body:\n%s", res.Body)
+	}
+}
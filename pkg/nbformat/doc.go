@@ -0,0 +1,2 @@
+// Package nbformat provides the types of the jupyter notebook format version 4.
+package nbformat
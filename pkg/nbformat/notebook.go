@@ -0,0 +1,318 @@
+package nbformat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Version is the major version of the supported notebook format.
+const Version = 4
+
+// ErrUnsupportedVersion is returned when the notebook format version is not
+// supported.
+var ErrUnsupportedVersion = errors.New("unsupported notebook format")
+
+// Notebook represents a jupyter notebook.
+type Notebook struct {
+	Cells         []Cell         `json:"cells"`
+	Metadata      map[string]any `json:"metadata"`
+	Nbformat      int            `json:"nbformat"`
+	NbformatMinor int            `json:"nbformat_minor"`
+}
+
+// Read decodes the notebook from the given JSON data.
+func Read(data []byte) (*Notebook, error) {
+	var notebook Notebook
+	err := json.Unmarshal(data, &notebook)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode notebook: %w", err)
+	}
+	if notebook.Nbformat != Version {
+		return nil, fmt.Errorf("%w: version %d", ErrUnsupportedVersion, notebook.Nbformat)
+	}
+	if notebook.Metadata == nil {
+		notebook.Metadata = make(map[string]any)
+	}
+	return &notebook, nil
+}
+
+// KernelName returns the name of the notebook kernelspec, or an empty string
+// if it's not set.
+func (n *Notebook) KernelName() string {
+	spec, _ := n.Metadata["kernelspec"].(map[string]any)
+	name, _ := spec["name"].(string)
+	return name
+}
+
+// Well-known cell types.
+const (
+	CellTypeCode     = "code"
+	CellTypeMarkdown = "markdown"
+	CellTypeRaw      = "raw"
+)
+
+// Cell represents a notebook cell. Outputs and execution count belong to the
+// code cells only.
+type Cell struct {
+	ID             string
+	CellType       string
+	Source         Text
+	Metadata       map[string]any
+	Attachments    map[string]any
+	Outputs        []Output
+	ExecutionCount *int
+}
+
+// cell is the encoded form of the cell.
+type cell struct {
+	ID             string         `json:"id,omitempty"`
+	CellType       string         `json:"cell_type"`
+	Source         Text           `json:"source"`
+	Metadata       map[string]any `json:"metadata"`
+	Attachments    map[string]any `json:"attachments,omitempty"`
+	Outputs        *[]Output      `json:"outputs,omitempty"`
+	ExecutionCount *int           `json:"execution_count,omitempty"`
+}
+
+// codeCell is the encoded form of the code cell, which keeps the null
+// execution count.
+type codeCell struct {
+	ID             string         `json:"id,omitempty"`
+	CellType       string         `json:"cell_type"`
+	Source         Text           `json:"source"`
+	Metadata       map[string]any `json:"metadata"`
+	Outputs        []Output       `json:"outputs"`
+	ExecutionCount *int           `json:"execution_count"`
+}
+
+// UnmarshalJSON decodes the cell.
+func (c *Cell) UnmarshalJSON(data []byte) error {
+	var decoded cell
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return err
+	}
+
+	*c = Cell{
+		ID:             decoded.ID,
+		CellType:       decoded.CellType,
+		Source:         decoded.Source,
+		Metadata:       decoded.Metadata,
+		Attachments:    decoded.Attachments,
+		ExecutionCount: decoded.ExecutionCount,
+	}
+	if decoded.Outputs != nil {
+		c.Outputs = *decoded.Outputs
+	}
+	return nil
+}
+
+// MarshalJSON encodes the cell.
+func (c Cell) MarshalJSON() ([]byte, error) {
+	metadata := c.Metadata
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+
+	if c.CellType == CellTypeCode {
+		outputs := c.Outputs
+		if outputs == nil {
+			outputs = []Output{}
+		}
+		return json.Marshal(codeCell{
+			ID:             c.ID,
+			CellType:       c.CellType,
+			Source:         c.Source,
+			Metadata:       metadata,
+			Outputs:        outputs,
+			ExecutionCount: c.ExecutionCount,
+		})
+	}
+
+	return json.Marshal(cell{
+		ID:          c.ID,
+		CellType:    c.CellType,
+		Source:      c.Source,
+		Metadata:    metadata,
+		Attachments: c.Attachments,
+	})
+}
+
+// Tags returns the tags of the cell.
+func (c *Cell) Tags() []string {
+	list, _ := c.Metadata["tags"].([]any)
+	tags := make([]string, 0, len(list))
+	for _, tag := range list {
+		if tag, ok := tag.(string); ok {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// HasTag returns true if the cell is tagged with the given tag.
+func (c *Cell) HasTag(tag string) bool {
+	for _, t := range c.Tags() {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Well-known output types.
+const (
+	OutputTypeStream        = "stream"
+	OutputTypeDisplayData   = "display_data"
+	OutputTypeExecuteResult = "execute_result"
+	OutputTypeError         = "error"
+)
+
+// Output represents an output of the code cell. The fields are set according
+// to the output type: name and text of the streams, data and metadata of the
+// displayed data and execution results, and the error details.
+type Output struct {
+	OutputType     string
+	Name           string
+	Text           Text
+	Data           map[string]any
+	Metadata       map[string]any
+	ExecutionCount *int
+	Ename          string
+	Evalue         string
+	Traceback      []string
+}
+
+// output is the decoded form of any output.
+type output struct {
+	OutputType     string         `json:"output_type"`
+	Name           string         `json:"name,omitempty"`
+	Text           Text           `json:"text,omitempty"`
+	Data           map[string]any `json:"data,omitempty"`
+	Metadata       map[string]any `json:"metadata,omitempty"`
+	ExecutionCount *int           `json:"execution_count,omitempty"`
+	Ename          string         `json:"ename,omitempty"`
+	Evalue         string         `json:"evalue,omitempty"`
+	Traceback      []string       `json:"traceback,omitempty"`
+}
+
+type streamOutput struct {
+	OutputType string `json:"output_type"`
+	Name       string `json:"name"`
+	Text       Text   `json:"text"`
+}
+
+type displayOutput struct {
+	OutputType string         `json:"output_type"`
+	Data       map[string]any `json:"data"`
+	Metadata   map[string]any `json:"metadata"`
+}
+
+type resultOutput struct {
+	OutputType     string         `json:"output_type"`
+	ExecutionCount *int           `json:"execution_count"`
+	Data           map[string]any `json:"data"`
+	Metadata       map[string]any `json:"metadata"`
+}
+
+type errorOutput struct {
+	OutputType string   `json:"output_type"`
+	Ename      string   `json:"ename"`
+	Evalue     string   `json:"evalue"`
+	Traceback  []string `json:"traceback"`
+}
+
+// UnmarshalJSON decodes the output.
+func (o *Output) UnmarshalJSON(data []byte) error {
+	var decoded output
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return err
+	}
+	*o = Output(decoded)
+	return nil
+}
+
+// MarshalJSON encodes the output with the fields required by its type.
+func (o Output) MarshalJSON() ([]byte, error) {
+	data := o.Data
+	if data == nil {
+		data = map[string]any{}
+	}
+	metadata := o.Metadata
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+
+	switch o.OutputType {
+	case OutputTypeStream:
+		return json.Marshal(streamOutput{
+			OutputType: o.OutputType,
+			Name:       o.Name,
+			Text:       o.Text,
+		})
+	case OutputTypeDisplayData:
+		return json.Marshal(displayOutput{
+			OutputType: o.OutputType,
+			Data:       data,
+			Metadata:   metadata,
+		})
+	case OutputTypeExecuteResult:
+		return json.Marshal(resultOutput{
+			OutputType:     o.OutputType,
+			ExecutionCount: o.ExecutionCount,
+			Data:           data,
+			Metadata:       metadata,
+		})
+	case OutputTypeError:
+		traceback := o.Traceback
+		if traceback == nil {
+			traceback = []string{}
+		}
+		return json.Marshal(errorOutput{
+			OutputType: o.OutputType,
+			Ename:      o.Ename,
+			Evalue:     o.Evalue,
+			Traceback:  traceback,
+		})
+	default:
+		return json.Marshal(output(o))
+	}
+}
+
+// Text represents a multiline string, which is encoded either as a single
+// string, or as a list of lines.
+type Text string
+
+// UnmarshalJSON decodes the text from a string or a list of lines.
+func (t *Text) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = Text(single)
+		return nil
+	}
+
+	var lines []string
+	err := json.Unmarshal(data, &lines)
+	if err != nil {
+		return err
+	}
+	*t = Text(strings.Join(lines, ""))
+	return nil
+}
+
+// MarshalJSON encodes the text as a list of lines, each with its line break.
+func (t Text) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Lines())
+}
+
+// Lines returns the lines of the text, each with its line break.
+func (t Text) Lines() []string {
+	lines := strings.SplitAfter(string(t), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
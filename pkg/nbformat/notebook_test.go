@@ -0,0 +1,102 @@
+package nbformat
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const testNotebook = `{
+  "cells": [
+    {"cell_type": "markdown", "metadata": {}, "source": ["# Title\n", "text"]},
+    {
+      "cell_type": "code",
+      "execution_count": 3,
+      "metadata": {"tags": ["skip-execution"]},
+      "outputs": [
+        {"output_type": "stream", "name": "stdout", "text": ["42\n"]},
+        {"output_type": "execute_result", "execution_count": 3, "data": {"text/plain": "42"}, "metadata": {}}
+      ],
+      "source": "x = 42\nprint(x)\nx"
+    },
+    {"cell_type": "code", "metadata": {}, "outputs": [], "source": []}
+  ],
+  "metadata": {"kernelspec": {"name": "ir", "display_name": "R"}},
+  "nbformat": 4,
+  "nbformat_minor": 5
+}`
+
+func TestRead(t *testing.T) {
+	notebook, err := Read([]byte(testNotebook))
+	if err != nil {
+		t.Fatalf("failed to read notebook: %v", err)
+	}
+	if name := notebook.KernelName(); name != "ir" {
+		t.Errorf("unexpected kernel name: %q", name)
+	}
+	if len(notebook.Cells) != 3 {
+		t.Fatalf("unexpected number of cells: %d", len(notebook.Cells))
+	}
+
+	code := notebook.Cells[1]
+	if code.Source != "x = 42\nprint(x)\nx" || !code.HasTag("skip-execution") {
+		t.Errorf("unexpected code cell: %+v", code)
+	}
+	if code.ExecutionCount == nil || *code.ExecutionCount != 3 || len(code.Outputs) != 2 {
+		t.Errorf("unexpected execution of code cell: %+v", code)
+	}
+	if code.Outputs[0].Text != "42\n" {
+		t.Errorf("unexpected stream text: %q", code.Outputs[0].Text)
+	}
+
+	_, err = Read([]byte(`{"cells": [], "metadata": {}, "nbformat": 3, "nbformat_minor": 0}`))
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("unexpected error of version 3: %v", err)
+	}
+}
+
+func TestNotebookMarshal(t *testing.T) {
+	notebook, err := Read([]byte(testNotebook))
+	if err != nil {
+		t.Fatalf("failed to read notebook: %v", err)
+	}
+
+	data, err := json.Marshal(notebook)
+	if err != nil {
+		t.Fatalf("failed to encode notebook: %v", err)
+	}
+	var encoded struct {
+		Cells []map[string]any `json:"cells"`
+	}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		t.Fatalf("failed to decode notebook: %v", err)
+	}
+
+	markdown := encoded.Cells[0]
+	if _, ok := markdown["outputs"]; ok {
+		t.Errorf("markdown cell has outputs: %v", markdown)
+	}
+	if !reflect.DeepEqual(markdown["source"], []any{"# Title\n", "text"}) {
+		t.Errorf("unexpected markdown source: %v", markdown["source"])
+	}
+
+	empty := encoded.Cells[2]
+	if count, ok := empty["execution_count"]; !ok || count != nil {
+		t.Errorf("unexpected execution count of empty cell: %v", empty)
+	}
+	if outputs, ok := empty["outputs"].([]any); !ok || len(outputs) != 0 {
+		t.Errorf("unexpected outputs of empty cell: %v", empty)
+	}
+
+	result := encoded.Cells[1]["outputs"].([]any)[1].(map[string]any)
+	expected := map[string]any{
+		"output_type":     "execute_result",
+		"execution_count": float64(3),
+		"data":            map[string]any{"text/plain": "42"},
+		"metadata":        map[string]any{},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected execute result: %v", result)
+	}
+}
@@ -0,0 +1,337 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/uclatall/ckhub/pkg/jupyter"
+)
+
+// Query represents an introspection query of the code, such as a completion
+// or a help request sent by editors.
+type Query struct {
+	Kernel string
+	// Session is an optional session, which instance answers the query so
+	// the names defined in the session are known. The session must belong
+	// to the Owner of the query.
+	Session uuid.UUID
+	Owner   string
+	Code    string
+	// Cursor is the cursor position within the code, in unicode characters.
+	Cursor int
+	// Detail is the level of the inspection details, 0 or 1.
+	Detail int
+}
+
+// Completion represents the completion matches of the code at the cursor.
+type Completion struct {
+	Matches     []string       `json:"matches"`
+	CursorStart int            `json:"cursor_start"`
+	CursorEnd   int            `json:"cursor_end"`
+	Meta        map[string]any `json:"metadata,omitempty"`
+}
+
+// Inspection represents the help text of the code at the cursor.
+type Inspection struct {
+	Found bool           `json:"found"`
+	Data  map[string]any `json:"data,omitempty"`
+	Meta  map[string]any `json:"metadata,omitempty"`
+}
+
+// Completeness represents the completeness status of the code: complete,
+// incomplete, invalid, or unknown.
+type Completeness struct {
+	Status string `json:"status"`
+	Indent string `json:"indent,omitempty"`
+}
+
+// ErrAssistDisabled is returned when the kernel has no assist pool.
+var ErrAssistDisabled = errors.New("assist disabled")
+
+// ErrAssistTimeout is returned when the kernel does not answer the query
+// within the assist timeout.
+var ErrAssistTimeout = errors.New("assist timeout")
+
+// assistant is an instance of the kernel dedicated to introspection queries.
+// The instance serves a single query at a time.
+type assistant struct {
+	mu   sync.Mutex
+	inst *instance
+}
+
+// Complete returns the completion matches of the query code.
+func (m *Manager) Complete(ctx context.Context, query *Query) (*Completion, error) {
+	msg, err := m.introspect(ctx, query, jupyter.MsgTypeCompleteReply, func(kernel *jupyter.Kernel, id uuid.UUID) error {
+		return kernel.Complete(id, query.Code, query.Cursor)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reply := msg.(*jupyter.MessageCompleteReply).Content
+	matches := reply.Matches
+	if matches == nil {
+		matches = []string{}
+	}
+	return &Completion{
+		Matches:     matches,
+		CursorStart: reply.CursorStart,
+		CursorEnd:   reply.CursorEnd,
+		Meta:        reply.MetaData,
+	}, nil
+}
+
+// Inspect returns the help text of the query code as a MIME bundle.
+func (m *Manager) Inspect(ctx context.Context, query *Query) (*Inspection, error) {
+	msg, err := m.introspect(ctx, query, jupyter.MsgTypeInspectReply, func(kernel *jupyter.Kernel, id uuid.UUID) error {
+		return kernel.Inspect(id, query.Code, query.Cursor, query.Detail)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reply := msg.(*jupyter.MessageInspectReply).Content
+	return &Inspection{
+		Found: reply.Found,
+		Data:  reply.Data,
+		Meta:  reply.MetaData,
+	}, nil
+}
+
+// IsComplete returns the completeness status of the query code.
+func (m *Manager) IsComplete(ctx context.Context, query *Query) (*Completeness, error) {
+	msg, err := m.introspect(ctx, query, jupyter.MsgTypeIsCompleteReply, func(kernel *jupyter.Kernel, id uuid.UUID) error {
+		return kernel.IsComplete(id, query.Code)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reply := msg.(*jupyter.MessageIsCompleteReply).Content
+	return &Completeness{
+		Status: reply.Status,
+		Indent: reply.Indent,
+	}, nil
+}
+
+// introspect sends the query request to the session instance, or to one of
+// the kernel assistants, and returns the reply of the given type.
+func (m *Manager) introspect(
+	ctx context.Context,
+	query *Query,
+	reply jupyter.MsgType,
+	send func(kernel *jupyter.Kernel, id uuid.UUID) error,
+) (jupyter.Message, error) {
+	kernel, ok := m.kernels[query.Kernel]
+	if !ok {
+		return nil, ErrKernelNotFound
+	}
+
+	if query.Session == uuid.Nil {
+		return kernel.introspect(ctx, reply, send)
+	}
+
+	m.mu.RLock()
+	session, ok := m.sessions[query.Session]
+	m.mu.RUnlock()
+	if !ok || session.kernel != kernel || session.owner != query.Owner {
+		return nil, ErrSessionNotFound
+	}
+	return session.introspect(ctx, reply, send)
+}
+
+func (s *Session) introspect(
+	ctx context.Context,
+	reply jupyter.MsgType,
+	send func(kernel *jupyter.Kernel, id uuid.UUID) error,
+) (jupyter.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, ErrSessionNotFound
+	}
+	defer func() { atomic.StoreInt64(&s.used, time.Now().UnixNano()) }()
+
+	ctx, cancel := context.WithTimeout(ctx, s.kernel.assist.timeout)
+	defer cancel()
+
+	return requestReply(ctx, s.instance.kernel, reply, send)
+}
+
+func (k *Kernel) introspect(
+	ctx context.Context,
+	reply jupyter.MsgType,
+	send func(kernel *jupyter.Kernel, id uuid.UUID) error,
+) (jupyter.Message, error) {
+	if k.assist.size == 0 {
+		return nil, ErrAssistDisabled
+	}
+
+	a, err := k.assistant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, k.assist.timeout)
+	defer cancel()
+
+	msg, err := requestReply(ctx, a.inst.kernel, reply, send)
+	if errors.Is(err, ErrKernelUnavailable) {
+		k.removeAssistant(a)
+	}
+	return msg, err
+}
+
+// assistant returns the next assistant of the kernel in a round-robin manner.
+// Assistants are spawned on demand until the pool reaches its size.
+func (k *Kernel) assistant(ctx context.Context) (*assistant, error) {
+	k.assist.mu.Lock()
+	n := len(k.assist.instances)
+	if n > 0 {
+		a := k.assist.instances[k.assist.next%n]
+		k.assist.next++
+		k.assist.mu.Unlock()
+
+		if n < k.assist.size && k.assist.spawn.TryLock() {
+			go func() {
+				defer k.assist.spawn.Unlock()
+				_ = k.addAssistant(context.Background())
+			}()
+		}
+		return a, nil
+	}
+	k.assist.mu.Unlock()
+
+	k.assist.spawn.Lock()
+	err := k.addAssistant(ctx)
+	k.assist.spawn.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return k.assistant(ctx)
+}
+
+// addAssistant spawns a new assistant unless the pool is full. The caller
+// must hold the spawn lock.
+func (k *Kernel) addAssistant(ctx context.Context) error {
+	k.assist.mu.Lock()
+	full := len(k.assist.instances) >= k.assist.size
+	k.assist.mu.Unlock()
+	if full {
+		return nil
+	}
+
+	k.mu.RLock()
+	closed := k.close
+	k.mu.RUnlock()
+	if closed {
+		return ErrKernelClosed
+	}
+
+	inst, err := k.spawnInstance(ctx)
+	if err != nil {
+		return err
+	}
+	a := &assistant{inst: inst}
+
+	if k.init != "" {
+		_, err := executeCode(ctx, inst.kernel, &Snippet{
+			ID:     uuid.New(),
+			Source: k.init,
+		})
+		if err != nil {
+			k.removeAssistant(a)
+			return fmt.Errorf("failed to init kernel: %w", err)
+		}
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.close {
+		go k.removeAssistant(a)
+		return ErrKernelClosed
+	}
+
+	k.assist.mu.Lock()
+	k.assist.instances = append(k.assist.instances, a)
+	k.assist.mu.Unlock()
+
+	return nil
+}
+
+// removeAssistant removes the given assistant from the pool and destroys its
+// instance.
+func (k *Kernel) removeAssistant(a *assistant) {
+	k.assist.mu.Lock()
+	for i, other := range k.assist.instances {
+		if other == a {
+			k.assist.instances = append(k.assist.instances[:i], k.assist.instances[i+1:]...)
+			break
+		}
+	}
+	k.assist.mu.Unlock()
+
+	_ = a.inst.backend.client.RemoveKernel(context.Background(), a.inst.kernel)
+	atomic.AddInt64(&a.inst.backend.instances, -1)
+}
+
+// requestReply sends the request with the given function, and waits for its
+// reply of the given type.
+func requestReply(
+	ctx context.Context,
+	kernel *jupyter.Kernel,
+	reply jupyter.MsgType,
+	send func(kernel *jupyter.Kernel, id uuid.UUID) error,
+) (jupyter.Message, error) {
+	err := kernel.Connect()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKernelUnavailable, err)
+	}
+	defer func() { _ = kernel.Close() }()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = kernel.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	id := uuid.New()
+	err = send(kernel, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	for {
+		msg, err := kernel.ReadMessage()
+		if err != nil {
+			switch {
+			case errors.Is(ctx.Err(), context.DeadlineExceeded):
+				return nil, ErrAssistTimeout
+			case ctx.Err() != nil:
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("failed to read message: %w", err)
+		}
+
+		if msg.GetMsgType() == reply && msg.IsChildByParentMsgID(id.String()) {
+			return msg, nil
+		}
+	}
+}
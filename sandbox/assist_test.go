@@ -0,0 +1,130 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+)
+
+func TestManagerComplete(t *testing.T) {
+	srv := jupytertest.NewServer("", nil)
+	defer srv.Close()
+	srv.SetIntrospection(jupytertest.Introspection{
+		Complete: func(token string) []string {
+			var matches []string
+			for _, name := range []string{"mean", "median", "max"} {
+				if strings.HasPrefix(name, token) {
+					matches = append(matches, name)
+				}
+			}
+			return matches
+		},
+	})
+
+	manager := newTestManager(t, `
+kernels:
+  - name: ir
+    kernel: ir
+    jupyter:
+      url: "{url}"
+    max: 1
+    assist:
+      size: 1
+`, srv)
+
+	for i := 0; i < 3; i++ {
+		completion, err := manager.Complete(context.Background(), &Query{
+			Kernel: "ir",
+			Code:   "x <- me(y)",
+			Cursor: 7,
+		})
+		if err != nil {
+			t.Fatalf("failed to complete: %v", err)
+		}
+		if !reflect.DeepEqual(completion.Matches, []string{"mean", "median"}) {
+			t.Errorf("unexpected matches: %v", completion.Matches)
+		}
+		if completion.CursorStart != 5 || completion.CursorEnd != 7 {
+			t.Errorf("unexpected cursor range: %d-%d", completion.CursorStart, completion.CursorEnd)
+		}
+	}
+
+	if created := srv.Created(); created != 1 {
+		t.Errorf("unexpected number of assistants: %d", created)
+	}
+	if instances := manager.kernels["ir"].Instances(); instances != 0 {
+		t.Errorf("assistants are taken from the execution pool: %d", instances)
+	}
+}
+
+func TestManagerInspectSession(t *testing.T) {
+	srv := jupytertest.NewServer("", nil)
+	defer srv.Close()
+	srv.SetIntrospection(jupytertest.Introspection{
+		Inspect: func(token string) map[string]any {
+			if token != "mean" {
+				return nil
+			}
+			return map[string]any{"text/plain": "Arithmetic Mean"}
+		},
+	})
+
+	manager := newTestManager(t, `
+kernels:
+  - name: ir
+    kernel: ir
+    jupyter:
+      url: "{url}"
+    max: 1
+    queue:
+      size: 1
+    sessions:
+      max: 1
+`, srv)
+
+	_, err := manager.Inspect(context.Background(), &Query{Kernel: "ir", Code: "mean"})
+	if !errors.Is(err, ErrAssistDisabled) {
+		t.Errorf("unexpected error without assist pool: %v", err)
+	}
+
+	session, err := manager.CreateSession(context.Background(), "ir", "")
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	inspection, err := manager.Inspect(context.Background(), &Query{
+		Kernel:  "ir",
+		Session: session.ID(),
+		Code:    "mean(x)",
+		Cursor:  4,
+	})
+	if err != nil {
+		t.Fatalf("failed to inspect: %v", err)
+	}
+	if !inspection.Found || inspection.Data["text/plain"] != "Arithmetic Mean" {
+		t.Errorf("unexpected inspection: %+v", inspection)
+	}
+
+	_, err = manager.Inspect(context.Background(), &Query{
+		Kernel:  "ir",
+		Session: session.ID(),
+		Owner:   "key:bob",
+		Code:    "mean",
+	})
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("unexpected error of foreign session: %v", err)
+	}
+
+	_, err = manager.Inspect(context.Background(), &Query{
+		Kernel:  "python",
+		Session: session.ID(),
+		Code:    "mean",
+	})
+	if !errors.Is(err, ErrKernelNotFound) {
+		t.Errorf("unexpected error of unknown kernel: %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package sandbox
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uclatall/ckhub/pkg/jupyter"
+)
+
+// BackendConfig represents a configuration of the jupyter server that hosts
+// kernel instances.
+type BackendConfig struct {
+	jupyter.Config `yaml:",inline"`
+	Weight         uint `json:"weight" yaml:"weight"`
+}
+
+// BalancePolicy represents a policy of the kernel instances distribution
+// across backends.
+type BalancePolicy uint
+
+// Well-known balance policies.
+const (
+	// BalancePolicyRoundRobin distributes instances proportionally to the
+	// backend weights.
+	BalancePolicyRoundRobin BalancePolicy = iota
+	// BalancePolicyLeastInstances places instances to the backend with the
+	// least number of instances relative to its weight.
+	BalancePolicyLeastInstances
+	balancePolicyCount
+)
+
+var balancePolicyOutput = []string{
+	"round-robin",
+	"least-instances",
+	"invalid",
+}
+
+// String returns a string form of the balance policy.
+func (policy BalancePolicy) String() string {
+	if policy >= balancePolicyCount {
+		return fmt.Sprintf("%s (%d)", balancePolicyOutput[balancePolicyCount], policy)
+	}
+	return balancePolicyOutput[policy]
+}
+
+// ErrBalancePolicyInvalid is returned when the balance policy is invalid.
+var ErrBalancePolicyInvalid = errors.New("invalid balance policy")
+
+// MarshalText marshals balance policy into text form.
+func (policy BalancePolicy) MarshalText() ([]byte, error) {
+	if policy >= balancePolicyCount {
+		return nil, ErrBalancePolicyInvalid
+	}
+	return []byte(balancePolicyOutput[policy]), nil
+}
+
+var balancePolicyInput = map[string]BalancePolicy{
+	"round-robin":     BalancePolicyRoundRobin,
+	"least-instances": BalancePolicyLeastInstances,
+}
+
+// UnmarshalText unmarshals balance policy from text form.
+func (policy *BalancePolicy) UnmarshalText(text []byte) error {
+	value, ok := balancePolicyInput[string(bytes.ToLower(text))]
+	if !ok {
+		return ErrBalancePolicyInvalid
+	}
+	*policy = value
+	return nil
+}
+
+// BackendStatus represents a status of the jupyter backend.
+type BackendStatus struct {
+	Address   string `json:"url"`
+	Weight    int    `json:"weight"`
+	Instances int    `json:"instances"`
+	Healthy   bool   `json:"healthy"`
+	Failures  int    `json:"failures,omitempty"`
+}
+
+// backend represents a jupyter server that hosts kernel instances.
+type backend struct {
+	client  *jupyter.Client
+	address string
+	weight  int64
+
+	instances int64
+	current   int64
+
+	mu       sync.Mutex
+	failures int
+	until    time.Time
+}
+
+// available returns true if the backend is not backed off at the given time.
+func (b *backend) available(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return !now.Before(b.until)
+}
+
+// fail records a failure of the backend. After the given number of
+// consecutive failures the backend is backed off, and the delay grows
+// exponentially up to the given limit. It returns the backoff delay.
+func (b *backend) fail(now time.Time, threshold int, delay, limit time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.failures < threshold {
+		return 0
+	}
+
+	for i := threshold; i < b.failures && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+
+	b.until = now.Add(delay)
+	return delay
+}
+
+// succeed resets failures of the backend.
+func (b *backend) succeed() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.until = time.Time{}
+}
+
+// status returns the current status of the backend.
+func (b *backend) status(now time.Time) BackendStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return BackendStatus{
+		Address:   b.address,
+		Weight:    int(b.weight),
+		Instances: int(atomic.LoadInt64(&b.instances)),
+		Healthy:   !now.Before(b.until),
+		Failures:  b.failures,
+	}
+}
+
+// addBackend appends a new backend with the given configuration to the
+// kernel.
+func (k *Kernel) addBackend(config BackendConfig, observer jupyter.ObserverFunc) error {
+	client, err := jupyter.NewClient(config.Config, jupyter.Observer(observer))
+	if err != nil {
+		return err
+	}
+
+	weight := int64(config.Weight)
+	if weight == 0 {
+		weight = 1
+	}
+
+	k.backends = append(k.backends, &backend{
+		client:  client,
+		address: config.Address,
+		weight:  weight,
+	})
+	return nil
+}
+
+// ErrNoBackends is returned when all kernel backends are unavailable.
+var ErrNoBackends = errors.New("no available backends")
+
+// selectBackend selects a backend for the new instance according to the
+// kernel balance policy, skipping the given ones.
+func (k *Kernel) selectBackend(now time.Time, skip map[*backend]bool) *backend {
+	k.balance.Lock()
+	defer k.balance.Unlock()
+
+	var (
+		selected *backend
+		total    int64
+	)
+
+	for _, b := range k.backends {
+		if skip[b] || !b.available(now) {
+			continue
+		}
+
+		switch k.policy {
+		case BalancePolicyLeastInstances:
+			// Compare instances/weight ratios without division.
+			if selected == nil ||
+				atomic.LoadInt64(&b.instances)*selected.weight <
+					atomic.LoadInt64(&selected.instances)*b.weight {
+				selected = b
+			}
+		default:
+			// Smooth weighted round-robin.
+			b.current += b.weight
+			total += b.weight
+			if selected == nil || b.current > selected.current {
+				selected = b
+			}
+		}
+	}
+
+	if selected != nil && k.policy == BalancePolicyRoundRobin {
+		selected.current -= total
+	}
+
+	return selected
+}
+
+// Backends returns statuses of the kernel backends.
+func (k *Kernel) Backends() []BackendStatus {
+	now := time.Now()
+
+	result := make([]BackendStatus, len(k.backends))
+	for i, b := range k.backends {
+		result[i] = b.status(now)
+	}
+	return result
+}
@@ -0,0 +1,155 @@
+package sandbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/uclatall/ckhub/pkg/jupyter"
+	"github.com/uclatall/ckhub/pkg/logging"
+)
+
+// ContentTypeVerdict is a MIME type of the display data that carries the check
+// verdict.
+const ContentTypeVerdict = "application/vnd.ckhub.verdict+json"
+
+// VerdictMarker is a prefix of the stream line that carries the JSON encoded
+// check verdict.
+const VerdictMarker = "CKHUB_VERDICT:"
+
+// Verdict represents a verdict of the snippet check.
+type Verdict struct {
+	Passed   bool     `json:"passed"`
+	Score    float64  `json:"score"`
+	Messages []string `json:"messages,omitempty"`
+}
+
+// ErrCheckNotFound is returned when the check file does not exist.
+var ErrCheckNotFound = errors.New("check not found")
+
+// loadCheck loads the source of the snippet check from the file in the checks
+// directory, if the snippet refers to one.
+func (m *Manager) loadCheck(snippet *Snippet) error {
+	if snippet.CheckFile == "" {
+		return nil
+	}
+	if m.checks == "" || !fs.ValidPath(snippet.CheckFile) {
+		return fmt.Errorf("%s: %w", snippet.CheckFile, ErrCheckNotFound)
+	}
+
+	source, err := fs.ReadFile(os.DirFS(m.checks), snippet.CheckFile)
+	if err != nil {
+		return fmt.Errorf("%s: %w", snippet.CheckFile, ErrCheckNotFound)
+	}
+	snippet.Check = string(source)
+
+	return nil
+}
+
+// checkSnippet runs the check of the executed snippet in the same instance,
+// and sets the verdict of the given result. Outputs of the check are not
+// visible to the caller. A check that fails to run fails the verdict, and
+// keeps the result of the snippet. It returns true if the instance state is
+// unknown afterwards.
+func (k *Kernel) checkSnippet(
+	ctx context.Context,
+	inst *instance,
+	snippet *Snippet,
+	result *Result,
+) bool {
+	if result.Status == StatusTimeout {
+		result.Verdict = &Verdict{Messages: []string{"execution timed out"}}
+		return true
+	}
+
+	check, err := k.executeSnippet(ctx, inst, &Snippet{
+		ID:      uuid.New(),
+		Kernel:  snippet.Kernel,
+		Source:  snippet.Check,
+		Timeout: snippet.Timeout,
+	})
+	if err != nil {
+		k.log.Warn("failed to run check", logging.Error(err))
+		result.Verdict = &Verdict{Messages: []string{fmt.Sprintf("failed to run check: %v", err)}}
+		return true
+	}
+	if check.Status == StatusTimeout {
+		result.Verdict = &Verdict{Messages: []string{"check timed out"}}
+		return true
+	}
+
+	result.Verdict = parseVerdict(check)
+	return false
+}
+
+// parseVerdict parses the verdict from the outputs of the check. The last
+// reported verdict wins, and errors raised by the check fail it.
+func parseVerdict(check *Result) *Verdict {
+	var verdict *Verdict
+	for _, output := range check.Outputs {
+		var v *Verdict
+		switch data := output.Data.(type) {
+		case map[string]any:
+			v = decodeVerdict(data[ContentTypeVerdict])
+		case jupyter.MessageStreamContent:
+			scanner := bufio.NewScanner(strings.NewReader(data.Text))
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if strings.HasPrefix(line, VerdictMarker) {
+					v = decodeVerdict(strings.TrimPrefix(line, VerdictMarker))
+				}
+			}
+		}
+		if v != nil {
+			verdict = v
+		}
+	}
+
+	if verdict == nil {
+		verdict = &Verdict{}
+		if len(check.Errors) == 0 {
+			verdict.Messages = append(verdict.Messages, "check reported no verdict")
+		}
+	}
+
+	for _, e := range check.Errors {
+		verdict.Passed = false
+		if data, ok := e.Data.(jupyter.MessageErrorContent); ok {
+			verdict.Messages = append(verdict.Messages, fmt.Sprintf("%s: %s", data.EName, data.EValue))
+		}
+	}
+
+	return verdict
+}
+
+// decodeVerdict decodes the verdict from either a JSON object, or its text
+// form. It returns nil if the value is not a verdict.
+func decodeVerdict(value any) *Verdict {
+	var data []byte
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case string:
+		data = []byte(value)
+	default:
+		var err error
+		data, err = json.Marshal(value)
+		if err != nil {
+			return nil
+		}
+	}
+
+	verdict := new(Verdict)
+	err := json.Unmarshal(data, verdict)
+	if err != nil {
+		return nil
+	}
+	return verdict
+}
@@ -0,0 +1,205 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/uclatall/ckhub/pkg/jupyter"
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+)
+
+func TestParseVerdict(t *testing.T) {
+	stream := func(text string) Output {
+		return Output{
+			Kind: OutputKindStream,
+			Data: jupyter.MessageStreamContent{Name: "stdout", Text: text},
+		}
+	}
+	display := func(value any) Output {
+		return Output{
+			Kind: OutputKindDisplayData,
+			Data: map[string]any{ContentTypeVerdict: value},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		check   Result
+		verdict Verdict
+	}{
+		{
+			name: "display data",
+			check: Result{Outputs: []Output{
+				display(map[string]any{"passed": true, "score": 1, "messages": []any{"well done"}}),
+			}},
+			verdict: Verdict{Passed: true, Score: 1, Messages: []string{"well done"}},
+		},
+		{
+			name:    "text display data",
+			check:   Result{Outputs: []Output{display(`{"passed": true, "score": 0.5}`)}},
+			verdict: Verdict{Passed: true, Score: 0.5},
+		},
+		{
+			name: "stream marker",
+			check: Result{Outputs: []Output{
+				stream("checking...\nCKHUB_VERDICT: {\"passed\": false, \"messages\": [\"wrong mean\"]}\n"),
+			}},
+			verdict: Verdict{Messages: []string{"wrong mean"}},
+		},
+		{
+			name: "last verdict wins",
+			check: Result{Outputs: []Output{
+				stream(`CKHUB_VERDICT: {"passed": false}`),
+				display(map[string]any{"passed": true}),
+			}},
+			verdict: Verdict{Passed: true},
+		},
+		{
+			name: "check error",
+			check: Result{
+				Outputs: []Output{display(map[string]any{"passed": true})},
+				Errors: []Error{{
+					Data: jupyter.MessageErrorContent{EName: "AssertionError", EValue: "x != 42"},
+				}},
+			},
+			verdict: Verdict{Messages: []string{"AssertionError: x != 42"}},
+		},
+		{
+			name:    "no verdict",
+			check:   Result{Outputs: []Output{stream("done")}},
+			verdict: Verdict{Messages: []string{"check reported no verdict"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict := parseVerdict(&tt.check)
+			if !reflect.DeepEqual(*verdict, tt.verdict) {
+				t.Errorf("unexpected verdict: %+v", *verdict)
+			}
+		})
+	}
+}
+
+func TestManagerLoadCheck(t *testing.T) {
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "ir"), 0o755)
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "ir", "mean.R"), []byte("check()"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write check: %v", err)
+	}
+
+	manager := &Manager{checks: dir}
+
+	snippet := &Snippet{CheckFile: "ir/mean.R"}
+	err = manager.loadCheck(snippet)
+	if err != nil {
+		t.Fatalf("failed to load check: %v", err)
+	}
+	if snippet.Check != "check()" {
+		t.Errorf("unexpected check source: %q", snippet.Check)
+	}
+
+	for _, name := range []string{"ir/missing.R", "../mean.R", "/etc/passwd"} {
+		err = manager.loadCheck(&Snippet{CheckFile: name})
+		if !errors.Is(err, ErrCheckNotFound) {
+			t.Errorf("unexpected error of %s: %v", name, err)
+		}
+	}
+}
+
+func TestKernelExecuteSnippetCheck(t *testing.T) {
+	srv := jupytertest.NewServer("", func(code string) jupytertest.Reply {
+		if code == "check()" {
+			return jupytertest.Reply{Outputs: []jupytertest.Output{
+				jupytertest.Stream("stdout", "hidden"),
+				jupytertest.DisplayData("", map[string]any{
+					ContentTypeVerdict: map[string]any{"passed": true, "score": 1},
+				}),
+			}}
+		}
+		return jupytertest.Echo(code)
+	})
+	defer srv.Close()
+
+	kernel := newTestKernel(t, srv, `
+    max: 1
+    queue:
+      size: 1
+    recycle:
+      policy: reuse-n
+      limit: 10
+`)
+
+	var events int
+	result, err := kernel.ExecuteSnippet(context.Background(), &Snippet{
+		ID:      uuid.New(),
+		Source:  "x <- 42",
+		Check:   "check()",
+		Handler: HandlerFunc(func(Event) { events++ }),
+	})
+	if err != nil {
+		t.Fatalf("failed to execute snippet: %v", err)
+	}
+
+	if len(result.Outputs) != 1 || events != 1 {
+		t.Errorf("check outputs are visible: %+v", result.Outputs)
+	}
+	if result.Verdict == nil || !result.Verdict.Passed || result.Verdict.Score != 1 {
+		t.Errorf("unexpected verdict: %+v", result.Verdict)
+	}
+
+	kernels := srv.Kernels()
+	var executions []string
+	for _, k := range kernels {
+		executions = append(executions, k.Executions()...)
+	}
+	if !reflect.DeepEqual(executions, []string{"x <- 42", "check()"}) {
+		t.Errorf("check is not executed in the same instance: %v", executions)
+	}
+}
+
+func TestKernelExecuteSnippetCheckFailure(t *testing.T) {
+	srv := jupytertest.NewServer("", func(code string) jupytertest.Reply {
+		if code == "check()" {
+			return jupytertest.Reply{Close: true}
+		}
+		return jupytertest.Echo(code)
+	})
+	defer srv.Close()
+
+	kernel := newTestKernel(t, srv, `
+    max: 1
+    queue:
+      size: 1
+`)
+
+	result, err := kernel.ExecuteSnippet(context.Background(), &Snippet{
+		ID:     uuid.New(),
+		Source: "x <- 42",
+		Check:  "check()",
+	})
+	if err != nil {
+		t.Fatalf("failed to execute snippet: %v", err)
+	}
+
+	if result.Status != StatusOK || len(result.Outputs) != 1 {
+		t.Errorf("result of the snippet is lost: %+v", result)
+	}
+	if result.Verdict == nil || result.Verdict.Passed || len(result.Verdict.Messages) != 1 ||
+		!strings.HasPrefix(result.Verdict.Messages[0], "failed to run check") {
+		t.Errorf("unexpected verdict: %+v", result.Verdict)
+	}
+
+	// The instance is destroyed, since its state is unknown.
+	eventually(t, func() bool { return kernel.Instances() == 0 })
+}
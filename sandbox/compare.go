@@ -0,0 +1,237 @@
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/uclatall/ckhub/pkg/jupyter"
+	"github.com/uclatall/ckhub/pkg/logging"
+)
+
+// Expectation describes the expected output of the snippet, given either as
+// text or as a solution snippet executed in a separate instance.
+type Expectation struct {
+	Output   string `json:"output,omitempty"`
+	Solution string `json:"solution,omitempty"`
+
+	// IgnoreWhitespace collapses whitespace and skips blank lines.
+	IgnoreWhitespace bool `json:"ignore_whitespace,omitempty"`
+	// Tolerance is the maximum absolute difference of the equal numbers.
+	Tolerance float64 `json:"tolerance,omitempty"`
+	// Unordered compares lines regardless of their order.
+	Unordered bool `json:"unordered,omitempty"`
+}
+
+// Comparison represents a result of the output comparison.
+type Comparison struct {
+	Match   bool   `json:"match"`
+	Diff    string `json:"diff,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// solutionWait is the maximum time the solution waits for a free instance of
+// the busy kernel pool, besides its execution timeout.
+const solutionWait = 30 * time.Second
+
+// compareOutput compares the output of the executed snippet with its
+// expectation, and sets the comparison of the given result. The solution that
+// fails to run is reported in the comparison message, so the result of the
+// snippet is kept.
+func (k *Kernel) compareOutput(ctx context.Context, snippet *Snippet, result *Result) {
+	expect := snippet.Expect
+
+	expected := expect.Output
+	if expect.Solution != "" {
+		solution := &Snippet{
+			ID:      uuid.New(),
+			Kernel:  snippet.Kernel,
+			Source:  expect.Solution,
+			Timeout: snippet.Timeout,
+		}
+
+		if timeout := k.executionTimeout(solution); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, solutionWait+timeout)
+			defer cancel()
+		}
+
+		res, err := k.executeWait(ctx, solution)
+		if err != nil {
+			k.log.Warn("failed to run solution", logging.Error(err))
+			result.Comparison = &Comparison{
+				Message: fmt.Sprintf("failed to run solution: %s", err),
+			}
+			return
+		}
+		if res.Status != StatusOK {
+			result.Comparison = &Comparison{
+				Message: fmt.Sprintf("solution failed with %s status", res.Status),
+			}
+			return
+		}
+		expected = outputText(res)
+	}
+
+	result.Comparison = compareText(expected, outputText(result), expect)
+}
+
+// outputText returns the text printed to stdout, and the plain text form of
+// the displayed data.
+func outputText(result *Result) string {
+	var b strings.Builder
+	for _, output := range result.Outputs {
+		var text string
+		switch data := output.Data.(type) {
+		case jupyter.MessageStreamContent:
+			if data.Name != "stdout" {
+				continue
+			}
+			text = data.Text
+		case map[string]any:
+			text, _ = data["text/plain"].(string)
+		}
+		if text == "" {
+			continue
+		}
+		b.WriteString(text)
+		if !strings.HasSuffix(text, "\n") {
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// maxDiffLines is the maximum number of the compared lines that are diffed.
+const maxDiffLines = 1000
+
+// compareText compares the normalized lines of the given texts.
+func compareText(expected, actual string, expect *Expectation) *Comparison {
+	want := normalizeLines(expected, expect)
+	got := normalizeLines(actual, expect)
+
+	equal := func(a, b string) bool {
+		return compareLine(a, b, expect.Tolerance)
+	}
+
+	match := len(want) == len(got)
+	for i := 0; match && i < len(want); i++ {
+		match = equal(want[i], got[i])
+	}
+	if match {
+		return &Comparison{Match: true}
+	}
+
+	// The diff takes quadratic memory, so long outputs are not diffed.
+	if len(want) > maxDiffLines || len(got) > maxDiffLines {
+		return &Comparison{Message: fmt.Sprintf("output too long to diff: more than %d lines", maxDiffLines)}
+	}
+	return &Comparison{Diff: diffLines(want, got, equal)}
+}
+
+// normalizeLines splits the text into lines, dropping the trailing whitespace
+// and blank lines at the end.
+func normalizeLines(text string, expect *Expectation) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	lines := strings.Split(text, "\n")
+	result := lines[:0]
+	for _, line := range lines {
+		if expect.IgnoreWhitespace {
+			line = strings.Join(strings.Fields(line), " ")
+			if line == "" {
+				continue
+			}
+		}
+		result = append(result, strings.TrimRight(line, " \t"))
+	}
+	for len(result) > 0 && result[len(result)-1] == "" {
+		result = result[:len(result)-1]
+	}
+
+	if expect.Unordered {
+		sort.Strings(result)
+	}
+	return result
+}
+
+// compareLine compares the given lines, treating numbers within the tolerance
+// as equal.
+func compareLine(a, b string, tolerance float64) bool {
+	if a == b {
+		return true
+	}
+	if tolerance <= 0 {
+		return false
+	}
+
+	as, bs := strings.Fields(a), strings.Fields(b)
+	if len(as) != len(bs) {
+		return false
+	}
+	for i := range as {
+		if as[i] == bs[i] {
+			continue
+		}
+		x, err := strconv.ParseFloat(as[i], 64)
+		if err != nil {
+			return false
+		}
+		y, err := strconv.ParseFloat(bs[i], 64)
+		if err != nil {
+			return false
+		}
+		if math.Abs(x-y) > tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+// diffLines returns a line diff of the expected and actual lines, based on
+// their longest common subsequence.
+func diffLines(want, got []string, equal func(a, b string) bool) string {
+	// lcs[i][j] is a length of the common subsequence of want[i:] and got[j:].
+	lcs := make([][]int, len(want)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(got)+1)
+	}
+	for i := len(want) - 1; i >= 0; i-- {
+		for j := len(got) - 1; j >= 0; j-- {
+			switch {
+			case equal(want[i], got[j]):
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("--- expected\n+++ actual\n")
+
+	i, j := 0, 0
+	for i < len(want) || j < len(got) {
+		switch {
+		case i < len(want) && j < len(got) && equal(want[i], got[j]):
+			b.WriteString(" " + got[j] + "\n")
+			i++
+			j++
+		case i < len(want) && (j == len(got) || lcs[i+1][j] >= lcs[i][j+1]):
+			b.WriteString("-" + want[i] + "\n")
+			i++
+		default:
+			b.WriteString("+" + got[j] + "\n")
+			j++
+		}
+	}
+	return b.String()
+}
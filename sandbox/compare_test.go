@@ -0,0 +1,156 @@
+package sandbox
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+)
+
+func TestCompareText(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		expect   Expectation
+		match    bool
+		diff     string
+		message  string
+	}{
+		{
+			name:     "exact",
+			expected: "a\nb\n",
+			actual:   "a\r\nb  \n\n",
+			match:    true,
+		},
+		{
+			name:     "mismatch",
+			expected: "a\nb\nc",
+			actual:   "a\nx\nc",
+			diff:     "--- expected\n+++ actual\n a\n-b\n+x\n c\n",
+		},
+		{
+			name:     "whitespace",
+			expected: "mean:  20.09\n\nsd: 6.03",
+			actual:   "mean: 20.09\nsd:    6.03",
+			expect:   Expectation{IgnoreWhitespace: true},
+			match:    true,
+		},
+		{
+			name:     "tolerance",
+			expected: "[1] 20.09062",
+			actual:   "[1] 20.091",
+			expect:   Expectation{Tolerance: 0.001},
+			match:    true,
+		},
+		{
+			name:     "out of tolerance",
+			expected: "[1] 20.09",
+			actual:   "[1] 20.2",
+			expect:   Expectation{Tolerance: 0.001},
+			diff:     "--- expected\n+++ actual\n-[1] 20.09\n+[1] 20.2\n",
+		},
+		{
+			name:     "unordered",
+			expected: "b\na\nc",
+			actual:   "c\nb\na",
+			expect:   Expectation{Unordered: true},
+			match:    true,
+		},
+		{
+			name:     "too long",
+			expected: strings.Repeat("a\n", maxDiffLines+1),
+			actual:   strings.Repeat("b\n", maxDiffLines+1),
+			message:  "output too long to diff: more than 1000 lines",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comparison := compareText(tt.expected, tt.actual, &tt.expect)
+			if comparison.Match != tt.match {
+				t.Errorf("unexpected match: %v", comparison.Match)
+			}
+			if comparison.Diff != tt.diff {
+				t.Errorf("unexpected diff:\n%s", comparison.Diff)
+			}
+			if comparison.Message != tt.message {
+				t.Errorf("unexpected message: %q", comparison.Message)
+			}
+		})
+	}
+}
+
+func TestKernelCompareOutputSolution(t *testing.T) {
+	srv := jupytertest.NewServer("", func(code string) jupytertest.Reply {
+		return jupytertest.Reply{Outputs: []jupytertest.Output{
+			jupytertest.Stream("stderr", "warning"),
+			jupytertest.ExecuteResult(map[string]any{"text/plain": "[1] " + code}),
+		}}
+	})
+	defer srv.Close()
+
+	kernel := newTestKernel(t, srv, `
+    max: 2
+    queue:
+      size: 1
+`)
+
+	snippet := &Snippet{
+		ID:     uuid.New(),
+		Source: "42",
+		Expect: &Expectation{Solution: "42.0001", Tolerance: 0.01},
+	}
+	result, err := kernel.ExecuteSnippet(context.Background(), snippet)
+	if err != nil {
+		t.Fatalf("failed to execute snippet: %v", err)
+	}
+	if result.Comparison == nil || !result.Comparison.Match {
+		t.Errorf("unexpected comparison: %+v", result.Comparison)
+	}
+	for _, k := range srv.Kernels() {
+		if len(k.Executions()) > 1 {
+			t.Errorf("solution is not executed in a separate instance: %v", k.Executions())
+		}
+	}
+}
+
+func TestKernelCompareOutputSolutionSingleInstance(t *testing.T) {
+	srv := jupytertest.NewServer("", func(code string) jupytertest.Reply {
+		return jupytertest.Reply{Outputs: []jupytertest.Output{
+			jupytertest.ExecuteResult(map[string]any{"text/plain": "[1] " + code}),
+		}}
+	})
+	defer srv.Close()
+
+	kernel := newTestKernel(t, srv, `
+    min: 1
+    max: 1
+    recycle:
+      policy: reset
+      reset: "reset()"
+`)
+	err := kernel.SpawnInstance(context.Background())
+	if err != nil {
+		t.Fatalf("failed to spawn instance: %v", err)
+	}
+
+	result, err := kernel.ExecuteSnippet(context.Background(), &Snippet{
+		ID:     uuid.New(),
+		Source: "42",
+		Expect: &Expectation{Solution: "43"},
+	})
+	if err != nil {
+		t.Fatalf("failed to execute snippet: %v", err)
+	}
+	if result.Comparison == nil || result.Comparison.Match || result.Comparison.Diff == "" {
+		t.Errorf("unexpected comparison: %+v", result.Comparison)
+	}
+
+	executions := srv.Kernels()[0].Executions()
+	if strings.Join(executions, ";") != "42;reset();43" {
+		t.Errorf("unexpected executions: %v", executions)
+	}
+}
@@ -1,32 +1,88 @@
 package sandbox
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"go.uber.org/multierr"
 
 	"github.com/uclatall/ckhub/pkg/jupyter"
+	"github.com/uclatall/ckhub/pkg/logging"
 )
 
 // Config represents a sandbox configuration.
 type Config struct {
 	Kernels []struct {
-		Name    string         `json:"name" yaml:"name"`
-		Init    string         `json:"init,omitempty" yaml:"init,omitempty"`
-		Jupyter jupyter.Config `json:"jupyter" yaml:"jupyter"`
-		Kernel  string         `json:"kernel" yaml:"kernel"`
-		Min     uint           `json:"min" yaml:"min"`
-		Max     uint           `json:"max" yaml:"max"`
+		Name     string          `json:"name" yaml:"name"`
+		Init     string          `json:"init,omitempty" yaml:"init,omitempty"`
+		Jupyter  jupyter.Config  `json:"jupyter,omitempty" yaml:"jupyter,omitempty"`
+		Backends []BackendConfig `json:"backends,omitempty" yaml:"backends,omitempty"`
+		Balance  BalancePolicy   `json:"balance" yaml:"balance"`
+		Failover struct {
+			Threshold  uint          `json:"threshold" yaml:"threshold"`
+			Backoff    time.Duration `json:"backoff" yaml:"backoff"`
+			MaxBackoff time.Duration `json:"max_backoff" yaml:"max_backoff"`
+		} `json:"failover" yaml:"failover"`
+		Kernel string `json:"kernel" yaml:"kernel"`
+		Min    uint   `json:"min" yaml:"min"`
+		Max    uint   `json:"max" yaml:"max"`
+		Queue  struct {
+			Size    uint          `json:"size" yaml:"size"`
+			Timeout time.Duration `json:"timeout" yaml:"timeout"`
+		} `json:"queue" yaml:"queue"`
+		Timeout    time.Duration `json:"timeout" yaml:"timeout"`
+		MaxTimeout time.Duration `json:"max_timeout" yaml:"max_timeout"`
+		Recycle    struct {
+			Policy RecyclePolicy `json:"policy" yaml:"policy"`
+			Reset  string        `json:"reset,omitempty" yaml:"reset,omitempty"`
+			Limit  uint          `json:"limit" yaml:"limit"`
+		} `json:"recycle" yaml:"recycle"`
+		Sessions struct {
+			Max      uint          `json:"max" yaml:"max"`
+			Idle     time.Duration `json:"idle" yaml:"idle"`
+			Lifetime time.Duration `json:"lifetime" yaml:"lifetime"`
+		} `json:"sessions" yaml:"sessions"`
+		Assist struct {
+			Size    uint          `json:"size" yaml:"size"`
+			Timeout time.Duration `json:"timeout" yaml:"timeout"`
+		} `json:"assist" yaml:"assist"`
 	} `json:"kernels" yaml:"kernels"`
+	Health time.Duration `json:"health" yaml:"health"`
+	Checks string        `json:"checks,omitempty" yaml:"checks,omitempty"`
+	Jobs   struct {
+		Workers uint          `json:"workers" yaml:"workers"`
+		Queue   uint          `json:"queue" yaml:"queue"`
+		TTL     time.Duration `json:"ttl" yaml:"ttl"`
+	} `json:"jobs" yaml:"jobs"`
 }
 
 // ErrDuplicateKernel is returned when a kernel with the same name is already
 // exists.
 var ErrDuplicateKernel = errors.New("duplicate kernel name")
 
+// ErrInvalidBackends is returned when the kernel backends are misconfigured.
+var ErrInvalidBackends = errors.New("invalid backends configuration")
+
+// ErrInvalidRecycle is returned when the recycle policy lacks its parameters.
+var ErrInvalidRecycle = errors.New("invalid recycle configuration")
+
 // Apply applies the given configuration to the manager.
 func (cfg Config) Apply(manager *Manager) error {
+	manager.health = cfg.Health
+	manager.checks = cfg.Checks
+
+	if cfg.Jobs.Workers > 0 {
+		manager.jobs.workers = int(cfg.Jobs.Workers)
+	}
+	if cfg.Jobs.Queue > 0 {
+		manager.jobs.queue = make(chan *Job, cfg.Jobs.Queue)
+	}
+	if cfg.Jobs.TTL > 0 {
+		manager.jobs.ttl = cfg.Jobs.TTL
+	}
+
 	errs := make([]error, len(cfg.Kernels))
 
 	for i, config := range cfg.Kernels {
@@ -35,19 +91,96 @@ func (cfg Config) Apply(manager *Manager) error {
 			continue
 		}
 
-		client, err := jupyter.NewClient(config.Jupyter)
-		if err != nil {
-			errs[i] = fmt.Errorf("failed to create client for %s: %w", config.Name, err)
+		switch {
+		case config.Recycle.Policy == RecyclePolicyReset && config.Recycle.Reset == "":
+			errs[i] = fmt.Errorf("%s: %w: reset snippet is required", config.Name, ErrInvalidRecycle)
+			continue
+		case config.Recycle.Policy == RecyclePolicyReuse && config.Recycle.Limit == 0:
+			errs[i] = fmt.Errorf("%s: %w: limit is required", config.Name, ErrInvalidRecycle)
 			continue
 		}
 
-		manager.kernels[config.Name] = &Kernel{
-			client: client,
+		backends := config.Backends
+		switch {
+		case len(backends) == 0:
+			backends = []BackendConfig{{Config: config.Jupyter, Weight: 1}}
+		case config.Jupyter.Address != "":
+			errs[i] = fmt.Errorf("%s: %w: both jupyter and backends are set", config.Name, ErrInvalidBackends)
+			continue
+		}
+
+		kernel := &Kernel{
+			log:    manager.log.Fields(logging.String("name", config.Name)),
+			stats:  manager.stats,
+			policy: config.Balance,
 			name:   config.Name,
+			spec:   config.Kernel,
 			init:   config.Init,
 			min:    int64(config.Min),
 			max:    int64(config.Max),
+			queue:  int(config.Queue.Size),
+			wait:   config.Queue.Timeout,
+
+			timeout:    config.Timeout,
+			maxTimeout: config.MaxTimeout,
+
+			recycle:      config.Recycle.Policy,
+			reset:        config.Recycle.Reset,
+			resetTimeout: config.Timeout,
+			uses:         config.Recycle.Limit,
+
+			maxSessions: int64(config.Sessions.Max),
+			idle:        config.Sessions.Idle,
+			lifetime:    config.Sessions.Lifetime,
+		}
+
+		if kernel.spec == "" {
+			kernel.spec = config.Name
+		}
+
+		if kernel.resetTimeout == 0 {
+			kernel.resetTimeout = 30 * time.Second
+		}
+		if kernel.maxSessions == 0 {
+			kernel.maxSessions = kernel.max
+		}
+
+		kernel.assist.size = int(config.Assist.Size)
+		kernel.assist.timeout = config.Assist.Timeout
+		if kernel.assist.timeout == 0 {
+			kernel.assist.timeout = 5 * time.Second
+		}
+
+		kernel.failover.threshold = int(config.Failover.Threshold)
+		if kernel.failover.threshold == 0 {
+			kernel.failover.threshold = 3
+		}
+		kernel.failover.backoff = config.Failover.Backoff
+		if kernel.failover.backoff == 0 {
+			kernel.failover.backoff = time.Second
+		}
+		kernel.failover.limit = config.Failover.MaxBackoff
+		if kernel.failover.limit == 0 {
+			kernel.failover.limit = time.Minute
+		}
+
+		berrs := make([]error, len(backends))
+		for j, backend := range backends {
+			berrs[j] = kernel.addBackend(backend, manager.stats.observer(config.Name))
 		}
+		err := multierr.Combine(berrs...)
+		if err != nil {
+			errs[i] = fmt.Errorf("failed to create client for %s: %w", config.Name, err)
+			continue
+		}
+
+		err = kernel.checkSpecs(context.Background())
+		if err != nil {
+			errs[i] = fmt.Errorf("%s: %w", config.Name, err)
+			continue
+		}
+
+		manager.kernels[config.Name] = kernel
 	}
 
 	err := multierr.Combine(errs...)
@@ -0,0 +1,84 @@
+package sandbox
+
+import (
+	"context"
+	"fmt"
+)
+
+// Handler is a generic interface of the snippet execution events handler.
+type Handler interface {
+	// Handle handles the given execution event. It is called synchronously
+	// as messages arrive from the kernel, so it should not block for long.
+	Handle(event Event)
+}
+
+// HandlerFunc is an adapter to allow the use of ordinary functions as
+// handlers.
+type HandlerFunc func(event Event)
+
+// Handle handles the given execution event.
+func (h HandlerFunc) Handle(event Event) {
+	h(event)
+}
+
+// Input is a generic interface of the snippet standard input.
+type Input interface {
+	// ReadInput reads the user input for the given prompt. It blocks the
+	// execution until the input is received or the context is canceled.
+	ReadInput(ctx context.Context, prompt string, password bool) (string, error)
+}
+
+// InputFunc is an adapter to allow the use of ordinary functions as inputs.
+type InputFunc func(ctx context.Context, prompt string, password bool) (string, error)
+
+// ReadInput reads the user input for the given prompt.
+func (f InputFunc) ReadInput(
+	ctx context.Context,
+	prompt string,
+	password bool,
+) (string, error) {
+	return f(ctx, prompt, password)
+}
+
+// Event represents an event emitted during the snippet execution.
+type Event struct {
+	Kind   EventKind
+	Output *Output
+	Error  *Error
+}
+
+// EventKind represents an event kind.
+type EventKind uint
+
+// Well-known event kinds.
+const (
+	EventKindNone EventKind = iota
+	EventKindOutput
+	EventKindError
+	EventKindClearOutput
+	eventKindCount
+)
+
+var eventKindOutput = []string{
+	"none",
+	"output",
+	"error",
+	"clear_output",
+	"invalid",
+}
+
+// String returns a string form of the event kind.
+func (kind EventKind) String() string {
+	if kind >= eventKindCount {
+		return fmt.Sprintf("%s (%d)", eventKindOutput[eventKindCount], kind)
+	}
+	return eventKindOutput[kind]
+}
+
+// MarshalText marshals event kind into text form.
+func (kind EventKind) MarshalText() ([]byte, error) {
+	if kind >= eventKindCount {
+		return nil, ErrEventKindInvalid
+	}
+	return []byte(eventKindOutput[kind]), nil
+}
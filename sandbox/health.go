@@ -0,0 +1,98 @@
+package sandbox
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/uclatall/ckhub/pkg/jupyter"
+	"github.com/uclatall/ckhub/pkg/logging"
+)
+
+// CheckInstances checks the state of the idle kernel instances, and evicts
+// dead, restarting, or missing ones from the pool. It returns the number of
+// evicted instances.
+func (k *Kernel) CheckInstances(ctx context.Context) int {
+	k.mu.RLock()
+	idle := make([]*instance, len(k.instances))
+	copy(idle, k.instances)
+	k.mu.RUnlock()
+
+	healthy := make([]bool, len(idle))
+
+	var wg sync.WaitGroup
+	for i, inst := range idle {
+		wg.Add(1)
+		go func(i int, inst *instance) {
+			defer wg.Done()
+			healthy[i] = k.checkInstance(ctx, inst)
+		}(i, inst)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return 0
+	}
+
+	dead := make(map[*instance]bool)
+	for i, inst := range idle {
+		if !healthy[i] {
+			dead[inst] = true
+		}
+	}
+	if len(dead) == 0 {
+		return 0
+	}
+
+	k.mu.Lock()
+	evicted := make([]*instance, 0, len(dead))
+	instances := k.instances[:0]
+	for _, inst := range k.instances {
+		if dead[inst] {
+			evicted = append(evicted, inst)
+			continue
+		}
+		instances = append(instances, inst)
+	}
+	k.instances = instances
+	k.mu.Unlock()
+
+	for _, inst := range evicted {
+		k.evictInstance(inst)
+	}
+
+	return len(evicted)
+}
+
+// Evicted returns the total number of the evicted kernel instances.
+func (k *Kernel) Evicted() int {
+	return int(atomic.LoadInt64(&k.evicted))
+}
+
+func (k *Kernel) checkInstance(ctx context.Context, inst *instance) bool {
+	state, err := inst.backend.client.KernelState(ctx, inst.kernel)
+	if err != nil {
+		// Missing and unreachable kernels are dead, unless the check itself
+		// is canceled.
+		return ctx.Err() != nil
+	}
+
+	switch state {
+	case jupyter.StateDead,
+		jupyter.StateAutoRestarting,
+		jupyter.StateRestarting,
+		jupyter.StateTerminating:
+		return false
+	default:
+		return true
+	}
+}
+
+// evictInstance removes the given broken instance, which is already taken
+// from the pool.
+func (k *Kernel) evictInstance(inst *instance) {
+	k.log.Debug("kernel evicted", logging.Stringer("kernel", inst.kernel.ID))
+	atomic.AddInt64(&k.evicted, 1)
+	k.stats.evictions.With(k.name).Inc()
+	go k.removeInstance(inst)
+}
@@ -0,0 +1,164 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/uclatall/ckhub/pkg/jupyter"
+	"github.com/uclatall/ckhub/pkg/logging"
+)
+
+// KernelInfo describes a configured kernel, its language and the state of its
+// pool.
+type KernelInfo struct {
+	Name        string `json:"name"`
+	Kernel      string `json:"kernel"`
+	DisplayName string `json:"display_name,omitempty"`
+
+	Language       string `json:"language,omitempty"`
+	Version        string `json:"version,omitempty"`
+	MimeType       string `json:"mimetype,omitempty"`
+	FileExtension  string `json:"file_extension,omitempty"`
+	CodemirrorMode any    `json:"codemirror_mode,omitempty"`
+
+	Min       int  `json:"min"`
+	Max       int  `json:"max"`
+	Instances int  `json:"instances"`
+	Idle      int  `json:"idle"`
+	Available bool `json:"available"`
+}
+
+// language contains the language details of the kernel. The display name,
+// the interrupt mode and the language name come from the kernel spec, and the
+// rest is reported by the kernel instances.
+type language struct {
+	mu        sync.RWMutex
+	display   string
+	interrupt string
+	info      jupyter.LanguageInfo
+	known     bool
+}
+
+// ErrUnknownKernelSpec is returned when the kernel is not available on its
+// backend.
+var ErrUnknownKernelSpec = errors.New("unknown kernel spec")
+
+// specTimeout is the maximum time to wait for the kernel specs of a backend.
+const specTimeout = 10 * time.Second
+
+// Info returns descriptions of the configured kernels, sorted by the kernel
+// name.
+func (m *Manager) Info() []KernelInfo {
+	now := time.Now()
+
+	result := make([]KernelInfo, 0, len(m.kernels))
+	for _, kernel := range m.kernels {
+		result = append(result, kernel.describe(now))
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// describe returns the description of the kernel at the given time. The
+// kernel is available if it has an idle instance, or can spawn a new one.
+func (k *Kernel) describe(now time.Time) KernelInfo {
+	k.language.mu.RLock()
+	info := KernelInfo{
+		Name:           k.name,
+		Kernel:         k.spec,
+		DisplayName:    k.language.display,
+		Language:       k.language.info.Name,
+		Version:        k.language.info.Version,
+		MimeType:       k.language.info.MimeType,
+		FileExtension:  k.language.info.FileExtension,
+		CodemirrorMode: k.language.info.CodemirrorMode,
+	}
+	k.language.mu.RUnlock()
+
+	info.Min = int(k.min)
+	info.Max = int(k.max)
+	info.Instances = k.Instances()
+	info.Idle = k.IdleInstances()
+
+	info.Available = info.Idle > 0
+	if !info.Available && info.Instances < info.Max {
+		for _, b := range k.backends {
+			if b.available(now) {
+				info.Available = true
+				break
+			}
+		}
+	}
+
+	return info
+}
+
+// checkSpecs verifies that the kernel is available on its backends. Backends
+// that cannot be reached are skipped, since they may come up later.
+func (k *Kernel) checkSpecs(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, specTimeout)
+	defer cancel()
+
+	for _, b := range k.backends {
+		specs, err := b.client.KernelSpecs(ctx)
+		if err != nil {
+			k.log.Warn(
+				"failed to get kernel specs",
+				logging.String("backend", b.address),
+				logging.Error(err),
+			)
+			continue
+		}
+
+		spec, ok := specs.KernelSpecs[k.spec]
+		if !ok {
+			return fmt.Errorf("%w: %s is not available on %s", ErrUnknownKernelSpec, k.spec, b.address)
+		}
+
+		k.language.mu.Lock()
+		k.language.display = spec.Spec.DisplayName
+		k.language.interrupt = spec.Spec.InterruptMode
+		if !k.language.known {
+			k.language.info.Name = spec.Spec.Language
+		}
+		k.language.mu.Unlock()
+	}
+
+	return nil
+}
+
+// learnLanguage requests the language details from the given instance, unless
+// they are already known.
+func (k *Kernel) learnLanguage(ctx context.Context, inst *instance) {
+	k.language.mu.RLock()
+	known := k.language.known
+	k.language.mu.RUnlock()
+	if known {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, k.assist.timeout)
+	defer cancel()
+
+	msg, err := requestReply(ctx, inst.kernel, jupyter.MsgTypeKernelInfoReply, func(kernel *jupyter.Kernel, id uuid.UUID) error {
+		return kernel.KernelInfo(id)
+	})
+	if err != nil {
+		k.log.Debug("failed to get kernel info", logging.Error(err))
+		return
+	}
+
+	k.language.mu.Lock()
+	k.language.info = msg.(*jupyter.MessageKernelInfoReply).Content.LanguageInfo
+	k.language.known = true
+	k.language.mu.Unlock()
+}
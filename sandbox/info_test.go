@@ -0,0 +1,66 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+)
+
+func TestConfigUnknownKernelSpec(t *testing.T) {
+	srv := jupytertest.NewServer("", nil)
+	defer srv.Close()
+
+	var cfg Config
+	err := yaml.Unmarshal([]byte(`
+kernels:
+  - name: julia
+    kernel: julia-1.9
+    jupyter:
+      url: "`+srv.URL()+`"
+`), &cfg)
+	if err != nil {
+		t.Fatalf("failed to decode config: %v", err)
+	}
+
+	_, err = NewManager(cfg)
+	if !errors.Is(err, ErrUnknownKernelSpec) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestManagerInfo(t *testing.T) {
+	srv := jupytertest.NewServer("", nil)
+	defer srv.Close()
+
+	manager := newTestManager(t, `
+kernels:
+  - name: r
+    kernel: ir
+    jupyter:
+      url: "{url}"
+    min: 1
+    max: 2
+`, srv)
+
+	info := manager.Info()
+	if len(info) != 1 || info[0].Language != "R" || info[0].Version != "" || !info[0].Available {
+		t.Fatalf("unexpected info before spawn: %+v", info)
+	}
+
+	err := manager.kernels["r"].SpawnInstance(context.Background())
+	if err != nil {
+		t.Fatalf("failed to spawn instance: %v", err)
+	}
+
+	info = manager.Info()
+	if info[0].Kernel != "ir" || info[0].Version != "4.3.1" || info[0].CodemirrorMode != "r" {
+		t.Errorf("unexpected language: %+v", info[0])
+	}
+	if info[0].Min != 1 || info[0].Max != 2 || info[0].Instances != 1 || info[0].Idle != 1 {
+		t.Errorf("unexpected pool state: %+v", info[0])
+	}
+}
@@ -0,0 +1,315 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/uclatall/ckhub/pkg/logging"
+)
+
+// JobState represents a state of the asynchronous job.
+type JobState string
+
+// Well-known states of the job.
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobDone      JobState = "done"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+// Final returns true if the job in the state is finished.
+func (s JobState) Final() bool {
+	return s == JobDone || s == JobFailed || s == JobCancelled
+}
+
+// ErrJobNotFound is returned when a job is not found.
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrTooManyJobs is returned when the jobs queue is full.
+var ErrTooManyJobs = errors.New("too many jobs")
+
+// ErrJobFinished is returned when a finished job is canceled.
+var ErrJobFinished = errors.New("job is finished")
+
+// Job represents an asynchronous execution of the snippet. It runs on the
+// kernel pool in the background, and its result is retained after the
+// execution for the configured time.
+type Job struct {
+	id      uuid.UUID
+	owner   string
+	kernel  *Kernel
+	snippet *Snippet
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu       sync.Mutex
+	state    JobState
+	created  time.Time
+	started  time.Time
+	finished time.Time
+	result   *Result
+	err      error
+}
+
+// JobStatus represents a state of the job along with its result.
+type JobStatus struct {
+	ID       uuid.UUID  `json:"id"`
+	Kernel   string     `json:"kernel"`
+	State    JobState   `json:"state"`
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Result   *Result    `json:"result,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// ID returns the job identifier.
+func (j *Job) ID() uuid.UUID {
+	return j.id
+}
+
+// Owner returns the owner of the job, as given on submission.
+func (j *Job) Owner() string {
+	return j.owner
+}
+
+// Kernel returns the name of the job kernel.
+func (j *Job) Kernel() string {
+	return j.kernel.name
+}
+
+// Done returns a channel that's closed when the job is finished.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Status returns the current status of the job.
+func (j *Job) Status() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	status := JobStatus{
+		ID:      j.id,
+		Kernel:  j.kernel.name,
+		State:   j.state,
+		Created: j.created,
+		Result:  j.result,
+	}
+	if !j.started.IsZero() {
+		started := j.started
+		status.Started = &started
+	}
+	if !j.finished.IsZero() {
+		finished := j.finished
+		status.Finished = &finished
+	}
+	if j.err != nil {
+		status.Error = j.err.Error()
+	}
+	return status
+}
+
+// Cancel cancels the job. A queued job is cancelled at once, and a running
+// one is interrupted and cancelled when its kernel stops the execution.
+func (j *Job) Cancel() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	switch j.state {
+	case JobQueued:
+		j.cancel()
+		j.finish(nil, context.Canceled)
+	case JobRunning:
+		j.cancel()
+	default:
+		return ErrJobFinished
+	}
+	return nil
+}
+
+// start marks the job as running, and returns false if it's cancelled.
+func (j *Job) start() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.state != JobQueued {
+		return false
+	}
+	j.state = JobRunning
+	j.started = time.Now()
+	return true
+}
+
+// complete records the execution result of the job.
+func (j *Job) complete(result *Result, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if !j.state.Final() {
+		j.finish(result, err)
+	}
+}
+
+// finish moves the job to the final state. The caller must hold the job lock.
+func (j *Job) finish(result *Result, err error) {
+	switch {
+	case err == nil:
+		j.state = JobDone
+		j.result = result
+	case errors.Is(err, context.Canceled) && j.ctx.Err() != nil:
+		j.state = JobCancelled
+	default:
+		j.state = JobFailed
+		j.err = err
+	}
+	j.finished = time.Now()
+
+	j.cancel()
+	close(j.done)
+}
+
+// expired returns true if the job is finished longer than the given time ago.
+func (j *Job) expired(now time.Time, ttl time.Duration) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.state.Final() && now.Sub(j.finished) > ttl
+}
+
+// jobs contains the asynchronous jobs of the manager.
+type jobs struct {
+	workers int
+	ttl     time.Duration
+	queue   chan *Job
+
+	mu    sync.Mutex
+	index map[uuid.UUID]*Job
+}
+
+// SubmitJob queues the given snippet of the owner for the asynchronous
+// execution. The job gets a random identifier, which does not depend on the
+// snippet one.
+func (m *Manager) SubmitJob(owner string, snippet *Snippet) (*Job, error) {
+	kernel, ok := m.kernels[snippet.Kernel]
+	if !ok {
+		return nil, ErrKernelNotFound
+	}
+
+	err := m.loadCheck(snippet)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		id:      uuid.New(),
+		owner:   owner,
+		kernel:  kernel,
+		snippet: snippet,
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		state:   JobQueued,
+		created: time.Now(),
+	}
+
+	m.jobs.mu.Lock()
+	defer m.jobs.mu.Unlock()
+
+	select {
+	case m.jobs.queue <- job:
+	default:
+		cancel()
+		return nil, ErrTooManyJobs
+	}
+	m.jobs.index[job.id] = job
+
+	m.log.Debug(
+		"job submitted",
+		logging.String("name", kernel.name),
+		logging.Stringer("job", job.id),
+		logging.Stringer("id", snippet.ID),
+	)
+
+	return job, nil
+}
+
+// Job returns the job with the given identifier.
+func (m *Manager) Job(id uuid.UUID) (*Job, error) {
+	m.jobs.mu.Lock()
+	defer m.jobs.mu.Unlock()
+
+	job, ok := m.jobs.index[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// runJobs executes the queued jobs with the given number of workers until the
+// context is canceled. The unfinished jobs are cancelled afterwards.
+func (m *Manager) runJobs(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(m.jobs.workers)
+	for i := 0; i < m.jobs.workers; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case job := <-m.jobs.queue:
+					m.runJob(job)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	<-ctx.Done()
+
+	m.jobs.mu.Lock()
+	for _, job := range m.jobs.index {
+		_ = job.Cancel()
+	}
+	m.jobs.mu.Unlock()
+
+	wg.Wait()
+}
+
+func (m *Manager) runJob(job *Job) {
+	if !job.start() {
+		return
+	}
+
+	// The job waits for the busy pool instead of failing, since the client is
+	// not there to retry.
+	result, err := job.kernel.executeWait(job.ctx, job.snippet)
+	job.complete(result, err)
+
+	status := job.Status()
+	m.log.Debug(
+		"job finished",
+		logging.String("name", job.kernel.name),
+		logging.Stringer("job", job.id),
+		logging.String("state", string(status.State)),
+	)
+}
+
+func (m *Manager) expireJobs(now time.Time) {
+	m.jobs.mu.Lock()
+	defer m.jobs.mu.Unlock()
+
+	for id, job := range m.jobs.index {
+		if job.expired(now, m.jobs.ttl) {
+			delete(m.jobs.index, id)
+		}
+	}
+}
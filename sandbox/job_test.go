@@ -0,0 +1,139 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+)
+
+// runTestManager runs the given manager until the test is finished.
+func runTestManager(t *testing.T, manager *Manager) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_ = manager.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// waitJob waits until the given job is finished.
+func waitJob(t *testing.T, job *Job) JobStatus {
+	t.Helper()
+
+	select {
+	case <-job.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("job is not finished: %s", job.Status().State)
+	}
+	return job.Status()
+}
+
+func TestManagerJob(t *testing.T) {
+	srv := jupytertest.NewServer("", jupytertest.Echo)
+	defer srv.Close()
+
+	manager := newTestManager(t, `
+kernels:
+  - name: python
+    kernel: python3
+    jupyter:
+      url: "{url}"
+    min: 1
+    max: 1
+jobs:
+  ttl: 1m
+`, srv)
+	runTestManager(t, manager)
+
+	snippet := &Snippet{ID: uuid.New(), Kernel: "python", Source: "print(42)"}
+	job, err := manager.SubmitJob("student", snippet)
+	if err != nil {
+		t.Fatalf("failed to submit job: %v", err)
+	}
+	if job.ID() == snippet.ID || job.Owner() != "student" {
+		t.Errorf("unexpected job: %s %q", job.ID(), job.Owner())
+	}
+	if _, err := manager.SubmitJob("student", &Snippet{ID: uuid.New(), Kernel: "r"}); !errors.Is(err, ErrKernelNotFound) {
+		t.Errorf("unexpected error of unknown kernel: %v", err)
+	}
+
+	status := waitJob(t, job)
+	if status.State != JobDone {
+		t.Fatalf("unexpected state: %s %s", status.State, status.Error)
+	}
+	if status.Result == nil || status.Result.Status != StatusOK || len(status.Result.Outputs) != 1 {
+		t.Errorf("unexpected result: %+v", status.Result)
+	}
+	if status.Started == nil || status.Finished == nil {
+		t.Errorf("unexpected timestamps: %v %v", status.Started, status.Finished)
+	}
+	if err := job.Cancel(); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("unexpected error of finished job cancel: %v", err)
+	}
+
+	manager.expireJobs(time.Now())
+	if _, err := manager.Job(job.ID()); err != nil {
+		t.Errorf("job is expired early: %v", err)
+	}
+	manager.expireJobs(time.Now().Add(2 * time.Minute))
+	if _, err := manager.Job(job.ID()); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("unexpected error of expired job: %v", err)
+	}
+}
+
+func TestManagerCancelJob(t *testing.T) {
+	srv := jupytertest.NewServer("", func(string) jupytertest.Reply {
+		return jupytertest.Reply{Hang: true}
+	})
+	defer srv.Close()
+
+	manager := newTestManager(t, `
+kernels:
+  - name: python
+    kernel: python3
+    jupyter:
+      url: "{url}"
+    min: 1
+    max: 1
+jobs:
+  workers: 1
+`, srv)
+	runTestManager(t, manager)
+
+	running, err := manager.SubmitJob("", &Snippet{ID: uuid.New(), Kernel: "python", Source: "while True: pass"})
+	if err != nil {
+		t.Fatalf("failed to submit job: %v", err)
+	}
+	queued, err := manager.SubmitJob("", &Snippet{ID: uuid.New(), Kernel: "python", Source: "print(42)"})
+	if err != nil {
+		t.Fatalf("failed to submit job: %v", err)
+	}
+	eventually(t, func() bool {
+		return running.Status().State == JobRunning
+	})
+
+	if err := queued.Cancel(); err != nil {
+		t.Fatalf("failed to cancel queued job: %v", err)
+	}
+	if status := waitJob(t, queued); status.State != JobCancelled || status.Started != nil {
+		t.Errorf("unexpected status of queued job: %+v", status)
+	}
+
+	if err := running.Cancel(); err != nil {
+		t.Fatalf("failed to cancel running job: %v", err)
+	}
+	if status := waitJob(t, running); status.State != JobCancelled {
+		t.Errorf("unexpected state of running job: %s %s", status.State, status.Error)
+	}
+}
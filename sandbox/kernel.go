@@ -6,26 +6,71 @@ import (
 	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"go.uber.org/multierr"
 
 	"github.com/uclatall/ckhub/pkg/jupyter"
+	"github.com/uclatall/ckhub/pkg/logging"
 )
 
 // Kernel is a thin wrapper around a jupyter kernel that provides access to
 // the kernel metdata.
 type Kernel struct {
-	client *jupyter.Client
+	log   logging.Logger
+	stats *stats
+
+	balance  sync.Mutex
+	backends []*backend
+	policy   BalancePolicy
+	failover struct {
+		threshold      int
+		backoff, limit time.Duration
+	}
 
 	name     string
+	spec     string
 	init     string
 	min, max int64
+	queue    int
+	wait     time.Duration
+
+	timeout, maxTimeout time.Duration
+
+	recycle      RecyclePolicy
+	reset        string
+	resetTimeout time.Duration
+	uses         uint
+
+	language language
+
+	sessions, maxSessions int64
+	idle, lifetime        time.Duration
+
+	assist struct {
+		size    int
+		timeout time.Duration
+
+		spawn     sync.Mutex
+		mu        sync.Mutex
+		next      int
+		instances []*assistant
+	}
 
 	mu        sync.RWMutex
 	close     bool
-	instances []*jupyter.Kernel
+	instances []*instance
+	waiters   []chan *instance
 	total     int64
+	evicted   int64
+}
+
+// instance represents a running instance of the kernel.
+type instance struct {
+	kernel  *jupyter.Kernel
+	backend *backend
+	uses    uint
 }
 
 // ErrKernelClosed is returned when the kernel is closed.
@@ -40,49 +85,129 @@ func (k *Kernel) SpawnInstance(ctx context.Context) error {
 	return k.createInstance(ctx)
 }
 
-// ErrTooManyRequests is returned when the kernel is at its limit.
+// ErrTooManyRequests is returned when the kernel is at its limit and its
+// queue is full.
 var ErrTooManyRequests = errors.New("too many requests")
 
-// ExecuteSnippet executes the given snippet.
+// ErrKernelUnavailable is returned when the kernel instance is unreachable.
+var ErrKernelUnavailable = errors.New("kernel unavailable")
+
+// ErrQueueTimeout is returned when no kernel instance became available within
+// the queue timeout.
+var ErrQueueTimeout = errors.New("queue timeout")
+
+// ExecuteSnippet executes the given snippet. If there are no idle instances,
+// it waits in the kernel queue until an instance becomes available, the queue
+// timeout expires, or the given context is canceled.
+//
+// The execution is interrupted when it exceeds the snippet timeout (or the
+// kernel default one), and the result collected so far is returned with the
+// timeout status.
 func (k *Kernel) ExecuteSnippet(
 	ctx context.Context,
 	snippet *Snippet,
 ) (*Result, error) {
+	inst, err := k.acquireInstance(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	k.mu.Lock()
+	result, err := k.executeSnippet(ctx, inst, snippet)
+	if errors.Is(err, ErrKernelUnavailable) {
+		// The instance died while idle, so give it one more try with another
+		// instance before reporting the failure.
+		k.evictInstance(inst)
 
-	if k.close {
-		return nil, ErrKernelClosed
+		inst, err = k.acquireInstance(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result, err = k.executeSnippet(ctx, inst, snippet)
 	}
 
-	if len(k.instances) == 0 {
-		k.mu.Unlock()
-		return nil, ErrTooManyRequests
+	failed := err != nil || result.Status == StatusTimeout
+	if err == nil && snippet.Check != "" {
+		failed = k.checkSnippet(ctx, inst, snippet, result)
 	}
-
-	kernel := k.instances[0]
-	k.instances = k.instances[1:]
-
-	if atomic.LoadInt64(&k.total) < k.max {
-		go func() {
-			_ = k.createInstance(context.Background())
-		}()
+	if err == nil && snippet.Expect != nil {
+		// The solution runs in another instance of the pool, so this one is
+		// recycled first instead of being held while waiting for another.
+		k.recycleInstance(inst, failed)
+		k.compareOutput(ctx, snippet, result)
+		return result, nil
 	}
 
-	k.mu.Unlock()
+	go k.recycleInstance(inst, failed)
 
-	result, err := executeCode(kernel, snippet.ID, snippet.Source)
+	if err != nil {
+		return nil, err
+	}
 
-	go func() {
-		_ = k.client.RemoveKernel(context.Background(), kernel)
-		atomic.AddInt64(&k.total, -1)
-	}()
+	return result, nil
+}
 
+// ExecuteSequence executes the given snippets one after another in the same
+// instance, so the state defined by a snippet is available for the following
+// ones. If the stop flag is set, the execution stops after the first failed
+// or timed out snippet. Otherwise, the timed out snippet is interrupted and
+// the execution goes on once the instance is idle again, while the instance
+// is destroyed afterwards. If the interruption is not confirmed, the execution
+// stops. It returns results of the executed snippets.
+func (k *Kernel) ExecuteSequence(
+	ctx context.Context,
+	snippets []*Snippet,
+	stop bool,
+) ([]*Result, error) {
+	inst, err := k.acquireInstance(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return result, nil
+	results := make([]*Result, 0, len(snippets))
+	failed := false
+	for _, snippet := range snippets {
+		snippet.Kernel = k.name
+		result, err := k.executeSnippet(ctx, inst, snippet)
+		if err != nil {
+			go k.recycleInstance(inst, true)
+			return nil, err
+		}
+		results = append(results, result)
+
+		if result.Status == StatusTimeout {
+			failed = true
+			// The following snippets would queue behind the execution that
+			// is still running.
+			if !stop && !waitIdle(ctx, inst) {
+				k.log.Warn("kernel is not idle after interruption", logging.Stringer("kernel", inst.kernel.ID))
+				break
+			}
+		}
+		if stop && (result.Status == StatusError || result.Status == StatusTimeout) {
+			break
+		}
+	}
+
+	go k.recycleInstance(inst, failed)
+	return results, nil
+}
+
+// retryDelay is the delay of the execution retry when the kernel pool is busy.
+const retryDelay = 500 * time.Millisecond
+
+// executeWait executes the given snippet, retrying while the kernel pool is
+// busy until the context is canceled.
+func (k *Kernel) executeWait(ctx context.Context, snippet *Snippet) (*Result, error) {
+	result, err := k.ExecuteSnippet(ctx, snippet)
+	for errors.Is(err, ErrTooManyRequests) || errors.Is(err, ErrQueueTimeout) {
+		select {
+		case <-time.After(retryDelay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		result, err = k.ExecuteSnippet(ctx, snippet)
+	}
+	return result, err
 }
 
 // Destroy destroys all kernel instances.
@@ -92,10 +217,24 @@ func (k *Kernel) Destroy() error {
 
 	k.close = true
 
+	for _, waiter := range k.waiters {
+		close(waiter)
+	}
+	k.waiters = nil
+
 	errs := make([]error, len(k.instances))
-	for i, kernel := range k.instances {
-		errs[i] = k.client.RemoveKernel(context.Background(), kernel)
+	for i, inst := range k.instances {
+		errs[i] = inst.backend.client.RemoveKernel(context.Background(), inst.kernel)
+		atomic.AddInt64(&inst.backend.instances, -1)
+	}
+
+	k.assist.mu.Lock()
+	for _, a := range k.assist.instances {
+		errs = append(errs, a.inst.backend.client.RemoveKernel(context.Background(), a.inst.kernel))
+		atomic.AddInt64(&a.inst.backend.instances, -1)
 	}
+	k.assist.instances = nil
+	k.assist.mu.Unlock()
 
 	err := multierr.Combine(errs...)
 	if err != nil {
@@ -109,11 +248,167 @@ func (k *Kernel) Instances() int {
 	return int(atomic.LoadInt64(&k.total))
 }
 
-func (k *Kernel) createInstance(ctx context.Context) error {
-	if atomic.LoadInt64(&k.total) >= k.max {
-		return nil
+// IdleInstances returns the number of idle kernel instances in the pool.
+func (k *Kernel) IdleInstances() int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return len(k.instances)
+}
+
+func (k *Kernel) acquireInstance(ctx context.Context) (*instance, error) {
+	k.mu.Lock()
+
+	if k.close {
+		k.mu.Unlock()
+		return nil, ErrKernelClosed
+	}
+
+	if len(k.instances) > 0 {
+		inst := k.instances[0]
+		k.instances = k.instances[1:]
+		k.mu.Unlock()
+
+		// The recycled instances come back to the pool, so it's kept warm by
+		// the minimum number of instances instead.
+		if k.recycle == RecyclePolicyDestroy {
+			k.replenish()
+		}
+		return inst, nil
 	}
 
+	if len(k.waiters) >= k.queue {
+		k.mu.Unlock()
+		k.stats.rejections.With(k.name, "queue_full").Inc()
+		return nil, ErrTooManyRequests
+	}
+
+	waiter := make(chan *instance, 1)
+	k.waiters = append(k.waiters, waiter)
+	k.mu.Unlock()
+
+	k.replenish()
+
+	var timeout <-chan time.Time
+	if k.wait > 0 {
+		timer := time.NewTimer(k.wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case inst, ok := <-waiter:
+		if !ok {
+			return nil, ErrKernelClosed
+		}
+		return inst, nil
+	case <-timeout:
+		k.stats.rejections.With(k.name, "queue_timeout").Inc()
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for i, w := range k.waiters {
+		if w == waiter {
+			k.waiters = append(k.waiters[:i], k.waiters[i+1:]...)
+			return nil, err
+		}
+	}
+
+	// The waiter has been already served, so the received instance must be
+	// returned back to the pool.
+	inst, ok := <-waiter
+	if ok {
+		k.releaseInstance(inst)
+	}
+
+	return nil, err
+}
+
+// releaseInstance hands the given instance over to the first waiter, or puts
+// it back to the pool. The caller must hold the kernel lock.
+func (k *Kernel) releaseInstance(inst *instance) {
+	if len(k.waiters) > 0 {
+		waiter := k.waiters[0]
+		k.waiters = k.waiters[1:]
+		waiter <- inst
+		return
+	}
+
+	k.instances = append(k.instances, inst)
+}
+
+// executionTimeout returns the execution timeout of the given snippet within
+// the kernel limits. Zero means the execution is not limited.
+func (k *Kernel) executionTimeout(snippet *Snippet) time.Duration {
+	timeout := k.timeout
+	if snippet.Timeout > 0 {
+		timeout = snippet.Timeout
+	}
+	if k.maxTimeout > 0 && timeout > k.maxTimeout {
+		timeout = k.maxTimeout
+	}
+	return timeout
+}
+
+// executeSnippet executes the given snippet in the given instance within the
+// execution timeout.
+func (k *Kernel) executeSnippet(
+	ctx context.Context,
+	inst *instance,
+	snippet *Snippet,
+) (*Result, error) {
+	timeout := k.executionTimeout(snippet)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	result, err := executeCode(ctx, inst.kernel, snippet)
+	k.stats.executionTime.With(k.name).Observe(time.Since(start).Seconds())
+
+	status := "failed"
+	if err == nil {
+		status = result.Status
+	}
+	k.stats.executions.With(k.name, status).Inc()
+
+	return result, err
+}
+
+// removeInstance removes the given instance, which is already taken from the
+// pool, and spawns a replacement if there are waiting requests.
+func (k *Kernel) removeInstance(inst *instance) {
+	_ = inst.backend.client.RemoveKernel(context.Background(), inst.kernel)
+	atomic.AddInt64(&inst.backend.instances, -1)
+	atomic.AddInt64(&k.total, -1)
+
+	k.mu.RLock()
+	waiting := len(k.waiters) > 0
+	k.mu.RUnlock()
+	if waiting {
+		k.replenish()
+	}
+}
+
+// replenish spawns a new instance in the background unless the kernel is
+// already at its limit.
+func (k *Kernel) replenish() {
+	if atomic.LoadInt64(&k.total) < k.max {
+		go func() {
+			_ = k.createInstance(context.Background())
+		}()
+	}
+}
+
+func (k *Kernel) createInstance(ctx context.Context) error {
 	k.mu.RLock()
 	if k.close {
 		k.mu.RUnlock()
@@ -121,82 +416,249 @@ func (k *Kernel) createInstance(ctx context.Context) error {
 	}
 	k.mu.RUnlock()
 
-	atomic.AddInt64(&k.total, 1)
+	for {
+		total := atomic.LoadInt64(&k.total)
+		if total >= k.max {
+			return nil
+		}
+		if atomic.CompareAndSwapInt64(&k.total, total, total+1) {
+			break
+		}
+	}
+
+	start := time.Now()
 
-	kernel, err := k.client.CreateKernel(ctx, k.name)
+	inst, err := k.spawnInstance(ctx)
 	if err != nil {
 		atomic.AddInt64(&k.total, -1)
-		return fmt.Errorf("failed to create kernel: %w", err)
+		k.stats.spawnFailures.With(k.name).Inc()
+		return err
 	}
 
 	if k.init != "" {
-		_, err := executeCode(kernel, uuid.New(), k.init)
+		_, err := executeCode(ctx, inst.kernel, &Snippet{
+			ID:     uuid.New(),
+			Source: k.init,
+		})
 		if err != nil {
-			_ = k.client.RemoveKernel(ctx, kernel)
-			atomic.AddInt64(&k.total, -1)
+			k.removeInstance(inst)
+			k.stats.spawnFailures.With(k.name).Inc()
 			return fmt.Errorf("failed to init kernel: %w", err)
 		}
 	}
+	k.stats.spawnTime.With(k.name).Observe(time.Since(start).Seconds())
+
+	k.learnLanguage(ctx, inst)
 
 	k.mu.Lock()
 	defer k.mu.Unlock()
 
 	if k.close {
-		_ = k.client.RemoveKernel(ctx, kernel)
-		atomic.AddInt64(&k.total, -1)
+		go k.removeInstance(inst)
 		return ErrKernelClosed
 	}
 
-	k.instances = append(k.instances, kernel)
+	k.releaseInstance(inst)
 
 	return nil
 }
 
-func executeCode(kernel *jupyter.Kernel, id uuid.UUID, code string) (*Result, error) {
+// spawnInstance creates a new jupyter kernel on one of the kernel backends.
+// Failed backends are backed off, and the next one is tried.
+func (k *Kernel) spawnInstance(ctx context.Context) (*instance, error) {
+	skip := make(map[*backend]bool, len(k.backends))
+	errs := make([]error, 0, len(k.backends))
+
+	for {
+		now := time.Now()
+
+		b := k.selectBackend(now, skip)
+		if b == nil {
+			errs = append(errs, ErrNoBackends)
+			return nil, fmt.Errorf("failed to create kernel: %w", multierr.Combine(errs...))
+		}
+		skip[b] = true
+
+		kernel, err := b.client.CreateKernel(ctx, k.spec)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.address, err))
+
+			delay := b.fail(now, k.failover.threshold, k.failover.backoff, k.failover.limit)
+			if delay > 0 {
+				k.log.Warn(
+					"backend unavailable",
+					logging.String("backend", b.address),
+					logging.Duration("backoff", delay),
+					logging.Error(err),
+				)
+			}
+			continue
+		}
+		b.succeed()
+
+		k.language.mu.RLock()
+		kernel.InterruptMode = k.language.interrupt
+		k.language.mu.RUnlock()
+
+		instances := atomic.AddInt64(&b.instances, 1)
+		k.log.Debug(
+			"kernel spawned",
+			logging.String("backend", b.address),
+			logging.Int64("instances", instances),
+		)
+
+		return &instance{kernel: kernel, backend: b}, nil
+	}
+}
+
+func executeCode(
+	ctx context.Context,
+	kernel *jupyter.Kernel,
+	snippet *Snippet,
+) (*Result, error) {
 	err := kernel.Connect()
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to kernel: %w", err)
+		return nil, fmt.Errorf("%w: %v", ErrKernelUnavailable, err)
 	}
 	defer func() { _ = kernel.Close() }()
 
-	err = kernel.Execute(id, code)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Unblock the pending read, so the execution can be interrupted.
+			_ = kernel.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	err = kernel.ExecuteRequest(snippet.ID, jupyter.MessageExecuteRequestContent{
+		Code:            snippet.Source,
+		Silent:          snippet.Silent,
+		StoreHistory:    snippet.StoreHistory && !snippet.Silent,
+		AllowStdin:      snippet.Input != nil,
+		StopOnError:     snippet.StopOnError,
+		UserExpressions: snippet.UserExpressions,
+	}, snippet.Metadata)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute code: %w", err)
 	}
 
-	result := &Result{}
+	result := &Result{ID: snippet.ID}
+
+	emit := func(event Event) {
+		if snippet.Handler != nil {
+			snippet.Handler.Handle(event)
+		}
+	}
+
+	// Clearing of the outputs, requested with wait flag, is postponed until
+	// the next output arrives.
+	pending := false
+	output := func(output Output) {
+		if pending {
+			pending = false
+			result.clear()
+			emit(Event{Kind: EventKindClearOutput})
+		}
+		result.Outputs = append(result.Outputs, output)
+		emit(Event{Kind: EventKindOutput, Output: &output})
+	}
 
 loop:
 	for {
 		msg, err := kernel.ReadMessage()
 		if err != nil {
-			return nil, fmt.Errorf("failed to read message: %w", err)
+			if ctx.Err() == nil {
+				return nil, fmt.Errorf("failed to read message: %w", err)
+			}
+
+			interrupt(kernel)
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, ctx.Err()
+			}
+
+			result.Status = StatusTimeout
+			return result, nil
 		}
 
-		if !msg.IsChildByParentMsgID(id.String()) {
+		if !msg.IsChildByParentMsgID(snippet.ID.String()) {
 			continue
 		}
 
 		switch msg := msg.(type) {
 		case *jupyter.MessageDisplayData:
-			result.Outputs = append(result.Outputs, Output{
-				Kind: OutputKindDisplayData,
+			output(Output{
+				Kind:      OutputKindDisplayData,
+				Data:      msg.Content.Data,
+				Meta:      msg.Content.MetaData,
+				DisplayID: msg.Content.Transient.DisplayID,
+			})
+		case *jupyter.MessageUpdateDisplayData:
+			update := Output{
+				Kind:      OutputKindUpdateDisplayData,
+				Data:      msg.Content.Data,
+				Meta:      msg.Content.MetaData,
+				DisplayID: msg.Content.Transient.DisplayID,
+			}
+			if result.update(update) {
+				emit(Event{Kind: EventKindOutput, Output: &update})
+			}
+		case *jupyter.MessageExecuteResult:
+			output(Output{
+				Kind: OutputKindExecuteResult,
 				Data: msg.Content.Data,
-				Meta: msg.MetaData,
+				Meta: msg.Content.MetaData,
 			})
+		case *jupyter.MessageClearOutput:
+			if msg.Content.Wait {
+				pending = true
+				continue
+			}
+			pending = false
+			result.clear()
+			emit(Event{Kind: EventKindClearOutput})
 		case *jupyter.MessageError:
-			result.Errors = append(result.Errors, Error{
-				Data: msg.Content,
-				Meta: msg.MetaData,
-			})
+			e := Error{
+				Data:     msg.Content,
+				Meta:     msg.MetaData,
+				Position: len(result.Outputs),
+			}
+			result.Errors = append(result.Errors, e)
+			emit(Event{Kind: EventKindError, Error: &e})
 		case *jupyter.MessageExecuteReply:
 			result.Status = msg.Content.Status
+			result.ExecutionCount = msg.Content.ExecutionCount
+			result.UserExpressions = msg.Content.UserExpressions
 		case *jupyter.MessageStream:
-			result.Outputs = append(result.Outputs, Output{
+			output(Output{
 				Kind: OutputKindStream,
 				Data: msg.Content,
 				Meta: msg.MetaData,
 			})
+		case *jupyter.MessageInputRequest:
+			if snippet.Input == nil {
+				continue
+			}
+			value, err := snippet.Input.ReadInput(
+				ctx,
+				msg.Content.Prompt,
+				msg.Content.Password,
+			)
+			if err != nil {
+				if ctx.Err() != nil {
+					// The pending read handles the interruption.
+					continue
+				}
+				interrupt(kernel)
+				return nil, fmt.Errorf("failed to read input: %w", err)
+			}
+			err = kernel.Input(msg.Header, value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to send input: %w", err)
+			}
 		case *jupyter.MessageStatus:
 			if msg.Content.ExecutionState == jupyter.StateIdle {
 				break loop
@@ -206,3 +668,38 @@ loop:
 
 	return result, nil
 }
+
+// interruptTimeout is the maximum time to wait for the kernel interruption.
+const interruptTimeout = 5 * time.Second
+
+// interrupt interrupts the execution of the given kernel. The execution
+// context is usually done at this point, so the interruption has its own.
+func interrupt(kernel *jupyter.Kernel) {
+	ctx, cancel := context.WithTimeout(context.Background(), interruptTimeout)
+	defer cancel()
+
+	_ = kernel.Interrupt(ctx)
+}
+
+// idlePoll is the interval of the kernel state polling.
+const idlePoll = 100 * time.Millisecond
+
+// waitIdle waits until the jupyter server reports the given instance idle,
+// which confirms the interruption of its execution. It returns false if the
+// instance is not idle within the interruption timeout.
+func waitIdle(ctx context.Context, inst *instance) bool {
+	ctx, cancel := context.WithTimeout(ctx, interruptTimeout)
+	defer cancel()
+
+	for {
+		state, err := inst.backend.client.KernelState(ctx, inst.kernel)
+		if err == nil && state == jupyter.StateIdle {
+			return true
+		}
+		select {
+		case <-time.After(idlePoll):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
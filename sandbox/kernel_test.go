@@ -0,0 +1,520 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+
+	"github.com/uclatall/ckhub/pkg/jupyter"
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+)
+
+// newTestManager creates a manager from the given yaml configuration, where
+// the {url} placeholders are replaced with the addresses of the given servers.
+func newTestManager(t *testing.T, config string, servers ...*jupytertest.Server) *Manager {
+	t.Helper()
+
+	for _, srv := range servers {
+		config = strings.Replace(config, "{url}", srv.URL(), 1)
+	}
+
+	var cfg Config
+	err := yaml.Unmarshal([]byte(config), &cfg)
+	if err != nil {
+		t.Fatalf("failed to decode config: %v", err)
+	}
+
+	manager, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, kernel := range manager.kernels {
+			_ = kernel.Destroy()
+		}
+	})
+	return manager
+}
+
+// newTestKernel creates a kernel from the given yaml configuration of a single
+// kernel, which runs on the given server.
+func newTestKernel(t *testing.T, srv *jupytertest.Server, config string) *Kernel {
+	t.Helper()
+
+	manager := newTestManager(t, fmt.Sprintf(`
+kernels:
+  - name: python
+    kernel: python3
+    jupyter:
+      url: "{url}"
+%s`, config), srv)
+	return manager.kernels["python"]
+}
+
+func createTestKernel(t *testing.T, srv *jupytertest.Server) *jupyter.Kernel {
+	t.Helper()
+
+	client, err := jupyter.NewClient(srv.Config())
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	kernel, err := client.CreateKernel(context.Background(), "python3")
+	if err != nil {
+		t.Fatalf("failed to create kernel: %v", err)
+	}
+	return kernel
+}
+
+// eventually waits until the given condition is met.
+func eventually(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition is not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestExecuteCode(t *testing.T) {
+	srv := jupytertest.NewServer("", func(code string) jupytertest.Reply {
+		return jupytertest.Reply{
+			Outputs: []jupytertest.Output{
+				jupytertest.Stream("stdout", "progress"),
+				jupytertest.ClearOutput(true),
+				jupytertest.DisplayData("plot", map[string]any{"text/plain": "v1"}),
+				jupytertest.UpdateDisplayData("plot", map[string]any{"text/plain": "v2"}),
+				jupytertest.UpdateDisplayData("unknown", map[string]any{"text/plain": "v3"}),
+				jupytertest.ExecuteResult(map[string]any{"text/plain": code}),
+				jupytertest.UpdateDisplayData("", map[string]any{"text/plain": "v4"}),
+				jupytertest.Error("ValueError", "boom"),
+			},
+			Status: StatusError,
+		}
+	})
+	defer srv.Close()
+
+	var events []EventKind
+	result, err := executeCode(context.Background(), createTestKernel(t, srv), &Snippet{
+		ID:     uuid.New(),
+		Source: "42",
+		Handler: HandlerFunc(func(event Event) {
+			events = append(events, event.Kind)
+		}),
+	})
+	if err != nil {
+		t.Fatalf("failed to execute code: %v", err)
+	}
+
+	if result.Status != StatusError {
+		t.Errorf("unexpected status: %q", result.Status)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Position != 2 {
+		t.Errorf("unexpected errors: %+v", result.Errors)
+	}
+
+	kinds := []OutputKind{OutputKindDisplayData, OutputKindExecuteResult}
+	if len(result.Outputs) != len(kinds) {
+		t.Fatalf("unexpected number of outputs: %d", len(result.Outputs))
+	}
+	for i, output := range result.Outputs {
+		if output.Kind != kinds[i] {
+			t.Errorf("unexpected kind of output %d: %s", i, output.Kind)
+		}
+	}
+	if data := result.Outputs[0].Data.(map[string]any); data["text/plain"] != "v2" {
+		t.Errorf("display data is not updated: %v", data)
+	}
+	if data := result.Outputs[1].Data.(map[string]any); data["text/plain"] != "42" {
+		t.Errorf("execute result is updated: %v", data)
+	}
+
+	expected := []EventKind{
+		EventKindOutput,
+		EventKindClearOutput,
+		EventKindOutput,
+		EventKindOutput,
+		EventKindOutput,
+		EventKindError,
+	}
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Errorf("unexpected events: %v", events)
+	}
+}
+
+func TestExecuteCodeTimeout(t *testing.T) {
+	srv := jupytertest.NewServer("", func(string) jupytertest.Reply {
+		return jupytertest.Reply{
+			Outputs: []jupytertest.Output{jupytertest.Stream("stdout", "started")},
+			Hang:    true,
+		}
+	})
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	result, err := executeCode(ctx, createTestKernel(t, srv), &Snippet{
+		ID:     uuid.New(),
+		Source: "while True: pass",
+	})
+	if err != nil {
+		t.Fatalf("failed to execute code: %v", err)
+	}
+	if result.Status != StatusTimeout {
+		t.Errorf("unexpected status: %q", result.Status)
+	}
+	if len(result.Outputs) != 1 {
+		t.Errorf("partial outputs are lost: %v", result.Outputs)
+	}
+
+	eventually(t, func() bool {
+		return srv.Kernels()[0].Interrupts() == 1
+	})
+}
+
+func TestExecuteCodeInput(t *testing.T) {
+	srv := jupytertest.NewServer("", func(string) jupytertest.Reply {
+		return jupytertest.Reply{
+			Outputs: []jupytertest.Output{jupytertest.InputRequest("name: ")},
+		}
+	})
+	defer srv.Close()
+
+	result, err := executeCode(context.Background(), createTestKernel(t, srv), &Snippet{
+		ID:     uuid.New(),
+		Source: "input('name: ')",
+		Input: InputFunc(func(_ context.Context, prompt string, _ bool) (string, error) {
+			return "ckhub:" + prompt, nil
+		}),
+	})
+	if err != nil {
+		t.Fatalf("failed to execute code: %v", err)
+	}
+	if len(result.Outputs) != 1 {
+		t.Fatalf("unexpected number of outputs: %d", len(result.Outputs))
+	}
+	stream := result.Outputs[0].Data.(jupyter.MessageStreamContent)
+	if stream.Text != "ckhub:name: " {
+		t.Errorf("unexpected input echo: %q", stream.Text)
+	}
+}
+
+func TestExecuteCodeUserExpressions(t *testing.T) {
+	srv := jupytertest.NewServer("", func(string) jupytertest.Reply {
+		return jupytertest.Reply{
+			UserExpressions: map[string]jupyter.UserExpression{
+				"nrow(df)": jupytertest.Value("32"),
+			},
+		}
+	})
+	defer srv.Close()
+
+	result, err := executeCode(context.Background(), createTestKernel(t, srv), &Snippet{
+		ID:     uuid.New(),
+		Source: "df <- mtcars",
+		UserExpressions: map[string]string{
+			"rows":  "nrow(df)",
+			"model": "model",
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to execute code: %v", err)
+	}
+
+	rows := result.UserExpressions["rows"]
+	if rows.Status != StatusOK || rows.Data["text/plain"] != "32" {
+		t.Errorf("unexpected value of rows: %+v", rows)
+	}
+	model := result.UserExpressions["model"]
+	if model.Status != StatusError || model.EName != "NameError" {
+		t.Errorf("unexpected value of model: %+v", model)
+	}
+}
+
+func TestKernelExecuteSnippet(t *testing.T) {
+	srv := jupytertest.NewServer("", nil)
+	defer srv.Close()
+
+	kernel := newTestKernel(t, srv, `
+    init: "import os"
+    min: 1
+    max: 1
+    recycle:
+      policy: reuse-n
+      limit: 2
+`)
+
+	err := kernel.SpawnInstance(context.Background())
+	if err != nil {
+		t.Fatalf("failed to spawn instance: %v", err)
+	}
+	if kernel.IdleInstances() != 1 {
+		t.Fatalf("unexpected number of idle instances: %d", kernel.IdleInstances())
+	}
+
+	first := srv.Kernels()[0]
+
+	for i := 0; i < 2; i++ {
+		result, err := kernel.ExecuteSnippet(context.Background(), &Snippet{
+			ID:     uuid.New(),
+			Source: "print(1)",
+		})
+		if err != nil {
+			t.Fatalf("failed to execute snippet: %v", err)
+		}
+		if result.Status != StatusOK {
+			t.Errorf("unexpected status: %q", result.Status)
+		}
+		if i == 0 {
+			eventually(t, func() bool { return kernel.IdleInstances() == 1 })
+		}
+	}
+
+	// The instance reached its executions limit.
+	eventually(t, func() bool { return kernel.Instances() == 0 })
+	if srv.Kernel(first.ID) != nil {
+		t.Error("used up instance is not removed")
+	}
+
+	executions := first.Executions()
+	if strings.Join(executions, ";") != "import os;print(1);print(1)" {
+		t.Errorf("unexpected executions: %v", executions)
+	}
+}
+
+func TestKernelQueue(t *testing.T) {
+	srv := jupytertest.NewServer("", nil)
+	defer srv.Close()
+
+	kernel := newTestKernel(t, srv, `
+    max: 1
+    queue:
+      size: 1
+      timeout: 100ms
+`)
+
+	err := kernel.createInstance(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	inst, err := kernel.acquireInstance(context.Background())
+	if err != nil {
+		t.Fatalf("failed to acquire instance: %v", err)
+	}
+
+	_, err = kernel.ExecuteSnippet(context.Background(), &Snippet{ID: uuid.New()})
+	if !errors.Is(err, ErrQueueTimeout) {
+		t.Errorf("unexpected error of timed out request: %v", err)
+	}
+
+	kernel.wait = 5 * time.Second
+
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := kernel.ExecuteSnippet(context.Background(), &Snippet{ID: uuid.New()})
+			done <- err
+		}()
+	}
+
+	err = <-done
+	if !errors.Is(err, ErrTooManyRequests) {
+		t.Errorf("unexpected error of rejected request: %v", err)
+	}
+
+	kernel.mu.Lock()
+	kernel.releaseInstance(inst)
+	kernel.mu.Unlock()
+
+	err = <-done
+	if err != nil {
+		t.Errorf("failed to execute queued request: %v", err)
+	}
+}
+
+func TestKernelFailover(t *testing.T) {
+	broken := jupytertest.NewServer("", nil)
+	defer broken.Close()
+	broken.FailCreate(100)
+
+	srv := jupytertest.NewServer("", nil)
+	defer srv.Close()
+
+	manager := newTestManager(t, `
+kernels:
+  - name: python
+    kernel: python3
+    max: 4
+    backends:
+      - url: "{url}"
+      - url: "{url}"
+    failover:
+      threshold: 1
+      backoff: 1m
+`, broken, srv)
+	kernel := manager.kernels["python"]
+
+	for i := 0; i < 4; i++ {
+		err := kernel.createInstance(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create instance: %v", err)
+		}
+	}
+
+	if broken.Created() != 0 || srv.Created() != 4 {
+		t.Errorf("unexpected instances: %d on broken, %d on healthy", broken.Created(), srv.Created())
+	}
+
+	backends := kernel.Backends()
+	if backends[0].Healthy || backends[0].Failures != 1 {
+		t.Errorf("broken backend is not backed off: %+v", backends[0])
+	}
+	if !backends[1].Healthy || backends[1].Instances != 4 {
+		t.Errorf("unexpected status of healthy backend: %+v", backends[1])
+	}
+}
+
+func TestKernelCheckInstances(t *testing.T) {
+	srv := jupytertest.NewServer("", nil)
+	defer srv.Close()
+
+	kernel := newTestKernel(t, srv, `
+    max: 3
+`)
+
+	for i := 0; i < 3; i++ {
+		err := kernel.createInstance(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create instance: %v", err)
+		}
+	}
+
+	kernels := srv.Kernels()
+	srv.Kill(kernels[0].ID)
+	kernels[1].SetState(jupyter.StateDead)
+
+	evicted := kernel.CheckInstances(context.Background())
+	if evicted != 2 {
+		t.Errorf("unexpected number of evicted instances: %d", evicted)
+	}
+	if kernel.IdleInstances() != 1 {
+		t.Errorf("unexpected number of idle instances: %d", kernel.IdleInstances())
+	}
+	eventually(t, func() bool { return kernel.Instances() == 1 })
+}
+
+func TestKernelRecyclePool(t *testing.T) {
+	srv := jupytertest.NewServer("", nil)
+	defer srv.Close()
+
+	kernel := newTestKernel(t, srv, `
+    min: 1
+    max: 3
+    recycle:
+      policy: reset
+      reset: "reset"
+`)
+
+	err := kernel.SpawnInstance(context.Background())
+	if err != nil {
+		t.Fatalf("failed to spawn instance: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err := kernel.ExecuteSnippet(context.Background(), &Snippet{ID: uuid.New(), Source: "print(1)"})
+		if err != nil {
+			t.Fatalf("failed to execute snippet: %v", err)
+		}
+		eventually(t, func() bool { return kernel.IdleInstances() == 1 })
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if kernel.Instances() != 1 {
+		t.Errorf("pool grows with recycled instances: %d", kernel.Instances())
+	}
+}
+
+func TestKernelResetTimeout(t *testing.T) {
+	srv := jupytertest.NewServer("", func(code string) jupytertest.Reply {
+		return jupytertest.Reply{Hang: code == "reset"}
+	})
+	defer srv.Close()
+
+	kernel := newTestKernel(t, srv, `
+    max: 1
+    recycle:
+      policy: reset
+      reset: "reset"
+`)
+	kernel.resetTimeout = 100 * time.Millisecond
+
+	err := kernel.createInstance(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	_, err = kernel.ExecuteSnippet(context.Background(), &Snippet{ID: uuid.New(), Source: "print(1)"})
+	if err != nil {
+		t.Fatalf("failed to execute snippet: %v", err)
+	}
+
+	// The instance with the hanging reset is destroyed, freeing the pool.
+	eventually(t, func() bool { return kernel.Instances() == 0 })
+}
+
+func TestKernelExecuteSequence(t *testing.T) {
+	srv := jupytertest.NewServer("", func(code string) jupytertest.Reply {
+		return jupytertest.Reply{
+			Outputs: []jupytertest.Output{jupytertest.Stream("stdout", code)},
+			Hang:    code == "hang()",
+			Stuck:   code == "stuck()",
+		}
+	})
+	defer srv.Close()
+
+	kernel := newTestKernel(t, srv, `
+    max: 1
+    queue:
+      size: 1
+`)
+
+	execute := func(t *testing.T, code string) []*Result {
+		t.Helper()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		var snippets []*Snippet
+		for _, source := range []string{"print(1)", code, "print(2)"} {
+			snippets = append(snippets, &Snippet{ID: uuid.New(), Source: source, Timeout: 100 * time.Millisecond})
+		}
+		results, err := kernel.ExecuteSequence(ctx, snippets, false)
+		if err != nil {
+			t.Fatalf("failed to execute sequence: %v", err)
+		}
+		return results
+	}
+
+	t.Run("interrupted", func(t *testing.T) {
+		results := execute(t, "hang()")
+		if len(results) != 3 || results[1].Status != StatusTimeout || results[2].Status != StatusOK {
+			t.Errorf("unexpected results: %+v", results)
+		}
+	})
+
+	t.Run("stuck", func(t *testing.T) {
+		// The kernel ignores the interruption, so the sequence stops.
+		results := execute(t, "stuck()")
+		if len(results) != 2 || results[1].Status != StatusTimeout {
+			t.Errorf("unexpected results: %+v", results)
+		}
+	})
+}
@@ -3,8 +3,11 @@ package sandbox
 import (
 	"context"
 	"errors"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"go.uber.org/multierr"
 
 	"github.com/uclatall/ckhub/pkg/logging"
@@ -12,17 +15,34 @@ import (
 
 // Manager implements a sandbox management service.
 type Manager struct {
-	log logging.Logger
+	log   logging.Logger
+	stats *stats
 
 	kernels map[string]*Kernel
 	spawn   time.Duration
+	health  time.Duration
+	checks  string
+
+	mu       sync.RWMutex
+	sessions map[uuid.UUID]*Session
+
+	jobs jobs
 }
 
 // NewManager creates a new sandbox manager with the given options.
 func NewManager(options ...Option) (*Manager, error) {
 	manager := &Manager{
 		log:     logging.NopLogger(),
+		stats:   newStats(),
 		kernels: make(map[string]*Kernel),
+
+		sessions: make(map[uuid.UUID]*Session),
+		jobs: jobs{
+			workers: 4,
+			ttl:     10 * time.Minute,
+			queue:   make(chan *Job, 100),
+			index:   make(map[uuid.UUID]*Job),
+		},
 	}
 
 	errs := make([]error, len(options))
@@ -43,10 +63,28 @@ func (m *Manager) Run(ctx context.Context) error {
 	log := m.log
 
 	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	var health <-chan time.Time
+	if m.health > 0 {
+		checker := time.NewTicker(m.health)
+		defer checker.Stop()
+		health = checker.C
+	}
+
+	jctx, stop := context.WithCancel(ctx)
+	defer stop()
+	jdone := make(chan struct{})
+	go func() {
+		m.runJobs(jctx)
+		close(jdone)
+	}()
 
 loop:
 	for {
 		select {
+		case <-health:
+			m.checkInstances(ctx)
 		case <-ticker.C:
 			for name, kernel := range m.kernels {
 				err := kernel.SpawnInstance(ctx)
@@ -58,6 +96,8 @@ loop:
 					)
 				}
 			}
+			m.expireSessions(time.Now())
+			m.expireJobs(time.Now())
 		case <-ctx.Done():
 			log.Debug("manager shutdown", logging.Error(ctx.Err()))
 			break loop
@@ -66,6 +106,16 @@ loop:
 
 	log = log.Hooks(logging.Span())
 
+	stop()
+	<-jdone
+
+	m.mu.Lock()
+	for id, session := range m.sessions {
+		session.Close()
+		delete(m.sessions, id)
+	}
+	m.mu.Unlock()
+
 	for _, kernel := range m.kernels {
 		err := kernel.Destroy()
 		if err != nil {
@@ -78,6 +128,23 @@ loop:
 	return nil
 }
 
+func (m *Manager) checkInstances(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, m.health)
+	defer cancel()
+
+	for name, kernel := range m.kernels {
+		evicted := kernel.CheckInstances(ctx)
+		if evicted > 0 {
+			m.log.Warn(
+				"evicted dead kernels",
+				logging.String("name", name),
+				logging.Int("evicted", evicted),
+				logging.Int("total", kernel.Evicted()),
+			)
+		}
+	}
+}
+
 // ErrKernelNotFound is returned when a kernel is not found.
 var ErrKernelNotFound = errors.New("kernel not found")
 
@@ -88,9 +155,46 @@ func (m *Manager) ExecuteSnippet(ctx context.Context, snippet *Snippet) (*Result
 		return nil, ErrKernelNotFound
 	}
 
+	err := m.loadCheck(snippet)
+	if err != nil {
+		return nil, err
+	}
+
 	return kernel.ExecuteSnippet(ctx, snippet)
 }
 
+// ExecuteSequence executes the given snippets one after another in the same
+// instance of the kernel with the given name.
+func (m *Manager) ExecuteSequence(
+	ctx context.Context,
+	name string,
+	snippets []*Snippet,
+	stop bool,
+) ([]*Result, error) {
+	kernel, ok := m.kernels[name]
+	if !ok {
+		return nil, ErrKernelNotFound
+	}
+	return kernel.ExecuteSequence(ctx, snippets, stop)
+}
+
+// ExecuteSnippetWait executes the given snippet like ExecuteSnippet, but waits
+// for an instance of the busy kernel pool until the context is canceled,
+// instead of rejecting the execution.
+func (m *Manager) ExecuteSnippetWait(ctx context.Context, snippet *Snippet) (*Result, error) {
+	kernel, ok := m.kernels[snippet.Kernel]
+	if !ok {
+		return nil, ErrKernelNotFound
+	}
+
+	err := m.loadCheck(snippet)
+	if err != nil {
+		return nil, err
+	}
+
+	return kernel.executeWait(ctx, snippet)
+}
+
 // Kernels returns the number of available kernels.
 func (m *Manager) Kernels() int {
 	total := 0
@@ -99,3 +203,136 @@ func (m *Manager) Kernels() int {
 	}
 	return total
 }
+
+// KernelStatus represents a status of the kernel pool.
+type KernelStatus struct {
+	Name      string          `json:"name"`
+	Instances int             `json:"instances"`
+	Idle      int             `json:"idle"`
+	Backends  []BackendStatus `json:"backends"`
+}
+
+// Status returns statuses of the kernel pools, sorted by the kernel name.
+func (m *Manager) Status() []KernelStatus {
+	result := make([]KernelStatus, 0, len(m.kernels))
+	for name, kernel := range m.kernels {
+		result = append(result, KernelStatus{
+			Name:      name,
+			Instances: kernel.Instances(),
+			Idle:      kernel.IdleInstances(),
+			Backends:  kernel.Backends(),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// CreateSession creates a new stateful session of the owner for the given
+// kernel. It takes an instance from the kernel pool, waiting in the queue if
+// necessary.
+func (m *Manager) CreateSession(ctx context.Context, name, owner string) (*Session, error) {
+	kernel, ok := m.kernels[name]
+	if !ok {
+		return nil, ErrKernelNotFound
+	}
+
+	session, err := kernel.createSession(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.sessions[session.id] = session
+	m.mu.Unlock()
+
+	m.log.Debug(
+		"session created",
+		logging.String("name", name),
+		logging.Stringer("session", session.id),
+	)
+
+	return session, nil
+}
+
+// Session returns the session with the given identifier.
+func (m *Manager) Session(id uuid.UUID) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+// ExecuteSession executes the given snippet in the session with the given
+// identifier.
+func (m *Manager) ExecuteSession(
+	ctx context.Context,
+	id uuid.UUID,
+	snippet *Snippet,
+) (*Result, error) {
+	m.mu.RLock()
+	session, ok := m.sessions[id]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	err := m.loadCheck(snippet)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := session.ExecuteSnippet(ctx, snippet)
+	if session.isClosed() {
+		m.removeSession(id)
+	}
+	return result, err
+}
+
+// CloseSession closes the session with the given identifier.
+func (m *Manager) CloseSession(id uuid.UUID) error {
+	session := m.removeSession(id)
+	if session == nil {
+		return ErrSessionNotFound
+	}
+
+	session.Close()
+	return nil
+}
+
+func (m *Manager) removeSession(id uuid.UUID) *Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil
+	}
+	delete(m.sessions, id)
+	return session
+}
+
+func (m *Manager) expireSessions(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, session := range m.sessions {
+		if !session.expire(now) {
+			continue
+		}
+
+		delete(m.sessions, id)
+
+		m.log.Debug(
+			"session expired",
+			logging.String("name", session.kernel.name),
+			logging.Stringer("session", id),
+		)
+	}
+}
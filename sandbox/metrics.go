@@ -0,0 +1,111 @@
+package sandbox
+
+import (
+	"time"
+
+	"github.com/uclatall/ckhub/pkg/jupyter"
+	"github.com/uclatall/ckhub/pkg/metrics"
+)
+
+// stats contains metrics of the sandbox kernels.
+type stats struct {
+	executions    *metrics.CounterVec
+	rejections    *metrics.CounterVec
+	spawnFailures *metrics.CounterVec
+	evictions     *metrics.CounterVec
+
+	executionTime *metrics.HistogramVec
+	spawnTime     *metrics.HistogramVec
+	jupyterTime   *metrics.HistogramVec
+}
+
+func newStats() *stats {
+	return &stats{
+		executions: metrics.NewCounterVec(
+			"ckhub_executions_total",
+			"Total number of snippet executions.",
+			"kernel", "status",
+		),
+		rejections: metrics.NewCounterVec(
+			"ckhub_rejections_total",
+			"Total number of executions rejected because of the empty pool.",
+			"kernel", "reason",
+		),
+		spawnFailures: metrics.NewCounterVec(
+			"ckhub_spawn_failures_total",
+			"Total number of failed kernel instance spawns.",
+			"kernel",
+		),
+		evictions: metrics.NewCounterVec(
+			"ckhub_evictions_total",
+			"Total number of dead kernel instances evicted from the pool.",
+			"kernel",
+		),
+		executionTime: metrics.NewHistogramVec(
+			"ckhub_execution_duration_seconds",
+			"Duration of the snippet executions.",
+			nil,
+			"kernel",
+		),
+		spawnTime: metrics.NewHistogramVec(
+			"ckhub_spawn_duration_seconds",
+			"Duration of the kernel instance spawns, including init script.",
+			nil,
+			"kernel",
+		),
+		jupyterTime: metrics.NewHistogramVec(
+			"ckhub_jupyter_request_duration_seconds",
+			"Duration of the jupyter server requests.",
+			nil,
+			"kernel", "operation", "status",
+		),
+	}
+}
+
+// observer returns an observer of the jupyter server requests for the kernel
+// with the given name.
+func (s *stats) observer(name string) jupyter.ObserverFunc {
+	return func(operation string, duration time.Duration, err error) {
+		status := "ok"
+		if err != nil {
+			status = "error"
+		}
+		s.jupyterTime.With(name, operation, status).Observe(duration.Seconds())
+	}
+}
+
+// collectors returns collectors of the sandbox metrics for the given manager.
+func (s *stats) collectors(manager *Manager) []metrics.Collector {
+	instances := metrics.NewGaugeFunc(
+		"ckhub_instances",
+		"Number of the running kernel instances, including busy ones.",
+		func(observe func(value float64, values ...string)) {
+			for name, kernel := range manager.kernels {
+				observe(float64(kernel.Instances()), name)
+			}
+		},
+		"kernel",
+	)
+	idle := metrics.NewGaugeFunc(
+		"ckhub_idle_instances",
+		"Number of the idle kernel instances in the pool.",
+		func(observe func(value float64, values ...string)) {
+			for name, kernel := range manager.kernels {
+				observe(float64(kernel.IdleInstances()), name)
+			}
+		},
+		"kernel",
+	)
+
+	return []metrics.Collector{
+		instances,
+		idle,
+		s.executions,
+		s.rejections,
+		s.spawnFailures,
+		s.evictions,
+		s.executionTime,
+		s.spawnTime,
+		s.jupyterTime,
+	}
+}
@@ -1,6 +1,9 @@
 package sandbox
 
-import "github.com/uclatall/ckhub/pkg/logging"
+import (
+	"github.com/uclatall/ckhub/pkg/logging"
+	"github.com/uclatall/ckhub/pkg/metrics"
+)
 
 // Option is a generic interface of the sandbox configuration option.
 type Option interface {
@@ -23,3 +26,12 @@ func Logger(log logging.Logger) OptionFunc {
 		return nil
 	}
 }
+
+// Metrics creates a new option that registers the sandbox metrics in the given
+// registry.
+func Metrics(registry *metrics.Registry) OptionFunc {
+	return func(srv *Manager) error {
+		registry.Register(srv.stats.collectors(srv)...)
+		return nil
+	}
+}
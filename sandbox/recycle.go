@@ -0,0 +1,110 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// RecyclePolicy represents a policy of the kernel instances recycling after
+// the snippet execution.
+type RecyclePolicy uint
+
+// Well-known recycle policies.
+const (
+	// RecyclePolicyDestroy destroys an instance after each execution.
+	RecyclePolicyDestroy RecyclePolicy = iota
+	// RecyclePolicyReset runs the reset snippet after each execution, and
+	// returns the instance back to the pool.
+	RecyclePolicyReset
+	// RecyclePolicyReuse returns the instance back to the pool until it
+	// reaches the executions limit.
+	RecyclePolicyReuse
+	recyclePolicyCount
+)
+
+var recyclePolicyOutput = []string{
+	"destroy",
+	"reset",
+	"reuse-n",
+	"invalid",
+}
+
+// String returns a string form of the recycle policy.
+func (policy RecyclePolicy) String() string {
+	if policy >= recyclePolicyCount {
+		return fmt.Sprintf("%s (%d)", recyclePolicyOutput[recyclePolicyCount], policy)
+	}
+	return recyclePolicyOutput[policy]
+}
+
+// ErrRecyclePolicyInvalid is returned when the recycle policy is invalid.
+var ErrRecyclePolicyInvalid = errors.New("invalid recycle policy")
+
+// MarshalText marshals recycle policy into text form.
+func (policy RecyclePolicy) MarshalText() ([]byte, error) {
+	if policy >= recyclePolicyCount {
+		return nil, ErrRecyclePolicyInvalid
+	}
+	return []byte(recyclePolicyOutput[policy]), nil
+}
+
+var recyclePolicyInput = map[string]RecyclePolicy{
+	"destroy": RecyclePolicyDestroy,
+	"reset":   RecyclePolicyReset,
+	"reuse-n": RecyclePolicyReuse,
+}
+
+// UnmarshalText unmarshals recycle policy from text form.
+func (policy *RecyclePolicy) UnmarshalText(text []byte) error {
+	value, ok := recyclePolicyInput[string(bytes.ToLower(text))]
+	if !ok {
+		return ErrRecyclePolicyInvalid
+	}
+	*policy = value
+	return nil
+}
+
+// recycleInstance returns the given instance back to the pool according to
+// the kernel recycle policy, or removes it. Failed instances are always
+// removed, since their state is unknown.
+func (k *Kernel) recycleInstance(inst *instance, failed bool) {
+	inst.uses++
+
+	switch {
+	case failed, k.recycle == RecyclePolicyDestroy:
+		k.removeInstance(inst)
+		return
+	case k.uses > 0 && inst.uses >= k.uses:
+		k.removeInstance(inst)
+		return
+	}
+
+	if k.reset != "" {
+		// The hanging reset must not hold the instance forever, so it always
+		// runs within the timeout.
+		ctx, cancel := context.WithTimeout(context.Background(), k.resetTimeout)
+		defer cancel()
+
+		result, err := executeCode(ctx, inst.kernel, &Snippet{
+			ID:     uuid.New(),
+			Source: k.reset,
+		})
+		if err != nil || result.Status != StatusOK {
+			k.removeInstance(inst)
+			return
+		}
+	}
+
+	k.mu.Lock()
+	if k.close {
+		k.mu.Unlock()
+		k.removeInstance(inst)
+		return
+	}
+	k.releaseInstance(inst)
+	k.mu.Unlock()
+}
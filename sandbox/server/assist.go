@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/uclatall/ckhub/pkg/logging"
+	"github.com/uclatall/ckhub/sandbox"
+)
+
+// ErrInvalidCursor is returned when the cursor position is outside the code.
+var ErrInvalidCursor = errors.New("cursor position is out of range")
+
+// assistRequest represents a body of the introspection request.
+type assistRequest struct {
+	Code        string    `json:"code"`
+	CursorPos   *int      `json:"cursor_pos,omitempty"`
+	DetailLevel int       `json:"detail_level,omitempty"`
+	Session     uuid.UUID `json:"session,omitempty"`
+}
+
+// Complete returns the completion matches of the code at the cursor.
+func (srv *Server) Complete(w http.ResponseWriter, req *http.Request) {
+	srv.assist(w, req, func(ctx context.Context, query *sandbox.Query) (any, error) {
+		return srv.manager.Complete(ctx, query)
+	})
+}
+
+// Inspect returns the help text of the code at the cursor as a MIME bundle.
+func (srv *Server) Inspect(w http.ResponseWriter, req *http.Request) {
+	srv.assist(w, req, func(ctx context.Context, query *sandbox.Query) (any, error) {
+		return srv.manager.Inspect(ctx, query)
+	})
+}
+
+// IsComplete returns the completeness status of the code.
+func (srv *Server) IsComplete(w http.ResponseWriter, req *http.Request) {
+	srv.assist(w, req, func(ctx context.Context, query *sandbox.Query) (any, error) {
+		return srv.manager.IsComplete(ctx, query)
+	})
+}
+
+func (srv *Server) assist(
+	w http.ResponseWriter,
+	req *http.Request,
+	answer func(ctx context.Context, query *sandbox.Query) (any, error),
+) {
+	log := srv.log.Hooks(logging.Span()).Fields(principalFields(req)...)
+
+	query, err := readQuery(req)
+	if err != nil {
+		log.Error("failed to read request", logging.Error(err))
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	log = log.Fields(logging.String("kernel", query.Kernel))
+	if !authorize(w, req, query.Kernel) {
+		return
+	}
+
+	result, err := answer(req.Context(), query)
+	if err != nil {
+		switch {
+		case errors.Is(err, sandbox.ErrSessionNotFound):
+			writeError(w, http.StatusNotFound, err)
+		case errors.Is(err, sandbox.ErrAssistDisabled):
+			writeError(w, http.StatusNotImplemented, err)
+		case errors.Is(err, sandbox.ErrAssistTimeout):
+			log.Warn("query timed out", logging.Error(err))
+			writeError(w, http.StatusGatewayTimeout, err)
+		default:
+			srv.writeExecuteError(w, log, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(result)
+	if err != nil {
+		log.Error("failed to write response", logging.Error(err))
+	}
+}
+
+// readQuery reads the introspection query from the given request. The cursor
+// defaults to the end of the code.
+func readQuery(req *http.Request) (*sandbox.Query, error) {
+	defer func() { _ = req.Body.Close() }()
+
+	var request assistRequest
+	err := json.NewDecoder(req.Body).Decode(&request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode body: %w", err)
+	}
+
+	length := utf8.RuneCountInString(request.Code)
+	cursor := length
+	if request.CursorPos != nil {
+		cursor = *request.CursorPos
+	}
+	if cursor < 0 || cursor > length {
+		return nil, ErrInvalidCursor
+	}
+
+	return &sandbox.Query{
+		Kernel:  strings.ToLower(chi.URLParam(req, "kernel")),
+		Session: request.Session,
+		Owner:   owner(req),
+		Code:    request.Code,
+		Cursor:  cursor,
+		Detail:  request.DetailLevel,
+	}, nil
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/uclatall/ckhub/pkg/logging"
+)
+
+// Principal represents an authenticated client of the server.
+type Principal struct {
+	// Name is the label of the API key, or the subject of the token.
+	Name string `json:"name"`
+	// Method is the authentication method: api_key or jwt.
+	Method string `json:"method"`
+	// Kernels are the kernels the principal is permitted to use. A nil list
+	// permits all kernels.
+	Kernels []string `json:"kernels,omitempty"`
+}
+
+// Well-known authentication methods.
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+// Permits returns true if the principal is permitted to use the given kernel.
+func (p *Principal) Permits(kernel string) bool {
+	if p.Kernels == nil {
+		return true
+	}
+	for _, k := range p.Kernels {
+		if k == "*" || strings.EqualFold(k, kernel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator authenticates requests to the server.
+type Authenticator interface {
+	// Authenticate returns the principal of the given request. It returns
+	// nil without error if the request carries no credentials of the kind the
+	// authenticator understands.
+	Authenticate(req *http.Request) (*Principal, error)
+}
+
+// ErrUnauthorized is returned when the request lacks valid credentials.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// ErrForbidden is returned when the principal is not permitted to use the
+// requested kernel.
+var ErrForbidden = errors.New("kernel is not permitted")
+
+type principalKey struct{}
+
+// ContextWithPrincipal returns a copy of the given context that carries the
+// given principal.
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal carried by the given context,
+// or nil if the request is anonymous.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// authenticate authenticates requests with the server authenticators, and
+// attaches the principal to the request context. All requests are anonymous
+// if there are no authenticators.
+func (srv *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if len(srv.auth) == 0 {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		for _, auth := range srv.auth {
+			principal, err := auth.Authenticate(req)
+			if err != nil {
+				srv.log.Warn(
+					"authentication failed",
+					logging.String("remote", req.RemoteAddr),
+					logging.Error(err),
+				)
+				writeUnauthorized(w)
+				return
+			}
+			if principal != nil {
+				next.ServeHTTP(w, req.WithContext(ContextWithPrincipal(req.Context(), principal)))
+				return
+			}
+		}
+
+		writeUnauthorized(w)
+	})
+}
+
+// authorize returns true if the principal of the request is permitted to use
+// the given kernel, and writes the forbidden response otherwise.
+func authorize(w http.ResponseWriter, req *http.Request, kernel string) bool {
+	if permits(req, kernel) {
+		return true
+	}
+
+	writeError(w, http.StatusForbidden, ErrForbidden)
+	return false
+}
+
+// permits returns true if the principal of the request is permitted to use
+// the given kernel.
+func permits(req *http.Request, kernel string) bool {
+	principal := PrincipalFromContext(req.Context())
+	return principal == nil || principal.Permits(kernel)
+}
+
+// owner returns the owner of the jobs and sessions created by the given
+// request: the authenticated principal, or nobody for anonymous requests.
+func owner(req *http.Request) string {
+	principal := PrincipalFromContext(req.Context())
+	if principal == nil {
+		return ""
+	}
+	return principal.Method + ":" + principal.Name
+}
+
+// principalFields returns log fields of the principal of the given request.
+func principalFields(req *http.Request) []logging.Field {
+	principal := PrincipalFromContext(req.Context())
+	if principal == nil {
+		return nil
+	}
+	return []logging.Field{
+		logging.String("principal", principal.Name),
+		logging.String("auth", principal.Method),
+	}
+}
+
+func writeUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="ckhub"`)
+	writeError(w, http.StatusUnauthorized, ErrUnauthorized)
+}
+
+// credentials returns the credentials of the request, taken from the bearer
+// authorization, the X-API-Key header, or the access_token query parameter
+// used by the websocket clients.
+func credentials(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	if key := req.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	return req.URL.Query().Get("access_token")
+}
+
+// APIKey represents a static API key, stored as a hex encoded SHA-256 hash.
+type APIKey struct {
+	Label   string   `json:"label" yaml:"label"`
+	Hash    string   `json:"hash" yaml:"hash"`
+	Kernels []string `json:"kernels,omitempty" yaml:"kernels,omitempty"`
+}
+
+// ErrInvalidAPIKey is returned when the API key configuration is invalid.
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// APIKeys authenticates requests with static API keys.
+type APIKeys struct {
+	keys map[[sha256.Size]byte]APIKey
+}
+
+// NewAPIKeys creates an authenticator of the given API keys.
+func NewAPIKeys(keys ...APIKey) (*APIKeys, error) {
+	auth := &APIKeys{keys: make(map[[sha256.Size]byte]APIKey, len(keys))}
+
+	for _, key := range keys {
+		hash, err := hex.DecodeString(strings.TrimPrefix(key.Hash, "sha256:"))
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("%w: %s: hash must be a hex encoded SHA-256", ErrInvalidAPIKey, key.Label)
+		}
+
+		var sum [sha256.Size]byte
+		copy(sum[:], hash)
+		if _, ok := auth.keys[sum]; ok {
+			return nil, fmt.Errorf("%w: %s: duplicate key", ErrInvalidAPIKey, key.Label)
+		}
+		auth.keys[sum] = key
+	}
+
+	return auth, nil
+}
+
+// ReadAPIKeys reads a yaml list of API keys from the file at the given path.
+func ReadAPIKeys(path string) ([]APIKey, error) {
+	//nolint:gosec // Reads API keys from the configured path.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys: %w", err)
+	}
+
+	var keys []APIKey
+	err = yaml.Unmarshal(data, &keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Authenticate returns the principal of the API key of the request. Tokens
+// shaped as JWT are left to the token authenticator.
+func (auth *APIKeys) Authenticate(req *http.Request) (*Principal, error) {
+	key := credentials(req)
+	if key == "" || isJWT(key) {
+		return nil, nil
+	}
+
+	// The lookup key is a hash of the secret, so the map access does not
+	// leak the timing of the secret comparison.
+	stored, ok := auth.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown API key", ErrUnauthorized)
+	}
+
+	return &Principal{
+		Name:    stored.Label,
+		Method:  MethodAPIKey,
+		Kernels: stored.Kernels,
+	}, nil
+}
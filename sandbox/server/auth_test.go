@@ -0,0 +1,259 @@
+package server
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+)
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// signToken returns a compact JWT of the given claims, signed with the given
+// algorithm and key.
+func signToken(t *testing.T, alg string, key any, claims map[string]any) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]any{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func bearer(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/execute/python", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestAPIKeys(t *testing.T) {
+	auth, err := NewAPIKeys(
+		APIKey{Label: "grader", Hash: hashKey("s3cret"), Kernels: []string{"ir"}},
+		APIKey{Label: "admin", Hash: "sha256:" + hashKey("adm1n")},
+	)
+	if err != nil {
+		t.Fatalf("failed to create authenticator: %v", err)
+	}
+
+	principal, err := auth.Authenticate(bearer("s3cret"))
+	if err != nil {
+		t.Fatalf("failed to authenticate: %v", err)
+	}
+	if principal.Name != "grader" || !principal.Permits("IR") || principal.Permits("python") {
+		t.Errorf("unexpected principal: %+v", principal)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/kernels?access_token=adm1n", nil)
+	principal, err = auth.Authenticate(req)
+	if err != nil || principal.Name != "admin" || !principal.Permits("python") {
+		t.Errorf("unexpected principal of query token: %+v, %v", principal, err)
+	}
+
+	_, err = auth.Authenticate(bearer("wrong"))
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("unexpected error of unknown key: %v", err)
+	}
+
+	principal, err = auth.Authenticate(bearer("a.b.c"))
+	if principal != nil || err != nil {
+		t.Errorf("token is handled by API keys: %+v, %v", principal, err)
+	}
+
+	_, err = NewAPIKeys(APIKey{Label: "plain", Hash: "s3cret"})
+	if !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("unexpected error of plain key: %v", err)
+	}
+}
+
+func TestJWT(t *testing.T) {
+	secret := []byte("shared")
+	now := time.Unix(1700000000, 0)
+
+	auth, err := NewJWT(JWTConfig{
+		Secret:   string(secret),
+		Issuer:   "https://coursekata.org",
+		Audience: "ckhub",
+	})
+	if err != nil {
+		t.Fatalf("failed to create authenticator: %v", err)
+	}
+	auth.now = func() time.Time { return now }
+
+	valid := map[string]any{
+		"sub":     "student-42",
+		"iss":     "https://coursekata.org",
+		"aud":     []string{"lms", "ckhub"},
+		"exp":     now.Add(time.Hour).Unix(),
+		"kernels": []string{"ir"},
+	}
+	with := func(key string, value any) map[string]any {
+		claims := make(map[string]any, len(valid))
+		for k, v := range valid {
+			claims[k] = v
+		}
+		claims[key] = value
+		return claims
+	}
+
+	principal, err := auth.Authenticate(bearer(signToken(t, "HS256", secret, valid)))
+	if err != nil {
+		t.Fatalf("failed to authenticate: %v", err)
+	}
+	expected := &Principal{Name: "student-42", Method: MethodJWT, Kernels: []string{"ir"}}
+	if !reflect.DeepEqual(principal, expected) {
+		t.Errorf("unexpected principal: %+v", principal)
+	}
+
+	principal, err = auth.Authenticate(bearer(signToken(t, "HS256", secret, with("kernels", []string{}))))
+	if err != nil || principal.Permits("ir") {
+		t.Errorf("empty kernels claim permits kernels: %+v, %v", principal, err)
+	}
+
+	unscoped := with("sub", "student-42")
+	delete(unscoped, "kernels")
+	principal, err = auth.Authenticate(bearer(signToken(t, "HS256", secret, unscoped)))
+	if err != nil || principal.Permits("ir") {
+		t.Errorf("missing kernels claim permits kernels: %+v, %v", principal, err)
+	}
+
+	unexpiring := with("sub", "student-42")
+	delete(unexpiring, "exp")
+
+	invalid := map[string]string{
+		"signature":  signToken(t, "HS256", []byte("other"), valid),
+		"algorithm":  signToken(t, "none", secret, valid),
+		"expired":    signToken(t, "HS256", secret, with("exp", now.Add(-time.Minute).Unix())),
+		"unexpiring": signToken(t, "HS256", secret, unexpiring),
+		"early":      signToken(t, "HS256", secret, with("nbf", now.Add(time.Minute).Unix())),
+		"issuer":     signToken(t, "HS256", secret, with("iss", "https://evil.org")),
+		"audience":   signToken(t, "HS256", secret, with("aud", "lms")),
+		"claim":      signToken(t, "HS256", secret, with("kernels", 42)),
+	}
+	for name, token := range invalid {
+		_, err := auth.Authenticate(bearer(token))
+		if !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("unexpected error of %s: %v", name, err)
+		}
+	}
+}
+
+func TestJWTPublicKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	auth, err := NewJWT(JWTConfig{PublicKeyFile: path, KernelsClaim: "scope"})
+	if err != nil {
+		t.Fatalf("failed to create authenticator: %v", err)
+	}
+
+	principal, err := auth.Authenticate(bearer(signToken(t, "RS256", key, map[string]any{
+		"sub":   "lti",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "ir python",
+	})))
+	if err != nil {
+		t.Fatalf("failed to authenticate: %v", err)
+	}
+	if !reflect.DeepEqual(principal.Kernels, []string{"ir", "python"}) {
+		t.Errorf("unexpected kernels: %v", principal.Kernels)
+	}
+
+	// The public key must not be accepted as a shared secret.
+	_, err = auth.Authenticate(bearer(signToken(t, "HS256", der, map[string]any{
+		"sub": "lti",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})))
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("unexpected error of HS256 token: %v", err)
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	jupyter := jupytertest.NewServer("", nil)
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+	err := Config{Auth: AuthConfig{Keys: []APIKey{
+		{Label: "python", Hash: hashKey("py"), Kernels: []string{"python"}},
+		{Label: "r", Hash: hashKey("r"), Kernels: []string{"ir"}},
+	}}}.Apply(srv)
+	if err != nil {
+		t.Fatalf("failed to configure auth: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		key    string
+		status int
+	}{
+		{name: "anonymous", path: "/api/v1/execute/python", status: http.StatusUnauthorized},
+		{name: "unknown key", path: "/api/v1/execute/python", key: "nope", status: http.StatusUnauthorized},
+		{name: "forbidden", path: "/api/v1/execute/python", key: "r", status: http.StatusForbidden},
+		{name: "permitted", path: "/api/v1/execute/python", key: "py", status: http.StatusOK},
+		{name: "health", path: "/healthz", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader("print(42)"))
+			if tt.path == "/healthz" {
+				req.Method = http.MethodGet
+			}
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", tt.key)
+			}
+			res := httptest.NewRecorder()
+			srv.mux.ServeHTTP(res, req)
+			if res.Code != tt.status {
+				t.Errorf("unexpected status: %d %s", res.Code, res.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/uclatall/ckhub/pkg/logging"
+	"github.com/uclatall/ckhub/sandbox"
+)
+
+// BatchConfig represents a configuration of the batch executions.
+type BatchConfig struct {
+	// Parallelism is the number of items of a batch executed concurrently.
+	Parallelism uint `json:"parallelism,omitempty" yaml:"parallelism,omitempty"`
+	// MaxItems is the maximum number of items in a batch.
+	MaxItems uint `json:"max_items,omitempty" yaml:"max_items,omitempty"`
+}
+
+// Apply applies the batch configuration to the given server.
+func (cfg BatchConfig) Apply(srv *Server) error {
+	if cfg.Parallelism > 0 {
+		srv.batch.parallelism = int(cfg.Parallelism)
+	}
+	if cfg.MaxItems > 0 {
+		srv.batch.items = int(cfg.MaxItems)
+	}
+	return nil
+}
+
+// batch contains the limits of the batch executions.
+type batch struct {
+	parallelism int
+	items       int
+}
+
+// ErrBatchTooLarge is returned when the batch has too many items.
+var ErrBatchTooLarge = errors.New("too many batch items")
+
+const contentTypeNDJSON = "application/x-ndjson"
+
+// batchItem represents an item of the batch execution request. The id of the
+// item is an opaque string echoed back in its result, and it shadows the id
+// of the execution request, so the snippet always gets a generated one.
+type batchItem struct {
+	ID     string `json:"id,omitempty"`
+	Kernel string `json:"kernel"`
+	executeRequest
+}
+
+// batchResult represents a result of the batch item. Either the result or
+// the error of the item is set.
+type batchResult struct {
+	Index  int             `json:"index"`
+	ID     string          `json:"id,omitempty"`
+	Kernel string          `json:"kernel"`
+	Result *sandbox.Result `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// batchResponse represents the results of the batch execution, in the order
+// of the items.
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+// ExecuteBatch executes the array of items, each with its kernel and code,
+// across the kernel pools. Failed items are reported in their results and do
+// not fail the batch. Requests accepting NDJSON receive the results as the
+// items complete.
+func (srv *Server) ExecuteBatch(w http.ResponseWriter, req *http.Request) {
+	log := srv.log.Hooks(logging.Span()).Fields(principalFields(req)...)
+
+	var items []batchItem
+	err := json.NewDecoder(req.Body).Decode(&items)
+	_ = req.Body.Close()
+	if err != nil {
+		log.Error("failed to read request", logging.Error(err))
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to decode body: %w", err))
+		return
+	}
+	if len(items) > srv.batch.items {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%w: %d > %d", ErrBatchTooLarge, len(items), srv.batch.items))
+		return
+	}
+
+	stream := strings.Contains(req.Header.Get("Accept"), contentTypeNDJSON)
+	var flusher http.Flusher
+	if stream {
+		var ok bool
+		flusher, ok = w.(http.Flusher)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, ErrStreamUnsupported)
+			return
+		}
+	}
+
+	indexes := make(chan int)
+	results := make(chan batchResult)
+
+	workers := srv.batch.parallelism
+	if workers > len(items) {
+		workers = len(items)
+	}
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				results <- srv.executeItem(req, index, items[index])
+			}
+		}()
+	}
+	go func() {
+		for index := range items {
+			indexes <- index
+		}
+		close(indexes)
+		wg.Wait()
+		close(results)
+	}()
+
+	if stream {
+		w.Header().Set("Content-Type", contentTypeNDJSON)
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+	}
+
+	response := batchResponse{Results: make([]batchResult, len(items))}
+	failed := 0
+	encoder := json.NewEncoder(w)
+	for result := range results {
+		if result.Error != "" {
+			failed++
+		}
+		if !stream {
+			response.Results[result.Index] = result
+			continue
+		}
+		if err := encoder.Encode(result); err == nil {
+			flusher.Flush()
+		}
+	}
+	log.Debug("batch complete", logging.Int("items", len(items)), logging.Int("failed", failed))
+
+	if stream {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = encoder.Encode(response)
+	if err != nil {
+		log.Error("failed to write response", logging.Error(err))
+	}
+}
+
+// executeItem executes the batch item within the global and the kernel limits
+// of the client, waiting for its kernel pool if it's busy, and returns its
+// result.
+func (srv *Server) executeItem(req *http.Request, index int, item batchItem) batchResult {
+	kernel := strings.ToLower(item.Kernel)
+	result := batchResult{Index: index, ID: item.ID, Kernel: kernel}
+
+	snippet, err := item.snippet(kernel)
+	switch {
+	case err != nil:
+	case snippet.Callback != "":
+		err = ErrCallbackUnsupported
+	case !permits(req, kernel):
+		err = ErrForbidden
+	default:
+		var release func()
+		release, err = srv.limitWait(req, kernel)
+		if err != nil {
+			break
+		}
+		result.Result, err = srv.manager.ExecuteSnippetWait(req.Context(), snippet)
+		release()
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
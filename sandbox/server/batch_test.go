@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+)
+
+func TestServerBatch(t *testing.T) {
+	jupyter := jupytertest.NewServer("", jupytertest.Echo)
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+	err := BatchConfig{Parallelism: 3, MaxItems: 5}.Apply(srv)
+	if err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+
+	const body = `[
+		{"kernel": "python", "code": "print(1)", "id": "first"},
+		{"kernel": "ir", "code": "print(2)"},
+		{"kernel": "Python", "code": "print(3)", "timeout": "soon"},
+		{"kernel": "python", "code": "print(4)", "id": "00000000-0000-0000-0000-000000000001"}
+	]`
+	batch := func(accept, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/batch", strings.NewReader(body))
+		req.Header.Set("Accept", accept)
+		res := httptest.NewRecorder()
+		srv.mux.ServeHTTP(res, req)
+		return res
+	}
+
+	res := batch("", body)
+	if res.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d %s", res.Code, res.Body)
+	}
+	var response struct {
+		Results []struct {
+			Index  int    `json:"index"`
+			ID     string `json:"id"`
+			Kernel string `json:"kernel"`
+			Result *struct {
+				Status string `json:"status"`
+			} `json:"result"`
+			Error string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(response.Results) != 4 {
+		t.Fatalf("unexpected number of results: %d", len(response.Results))
+	}
+	for i, result := range response.Results {
+		failed := i == 1 || i == 2
+		if result.Index != i || (result.Error != "") != failed || (result.Result == nil) != failed {
+			t.Errorf("unexpected result %d: %+v", i, result)
+		}
+	}
+	// The item ids are echoed back as is, and the items without one get none.
+	for i, id := range []string{"first", "", "", "00000000-0000-0000-0000-000000000001"} {
+		if response.Results[i].ID != id {
+			t.Errorf("unexpected id of item %d: %q", i, response.Results[i].ID)
+		}
+	}
+	if response.Results[2].Kernel != "python" {
+		t.Errorf("unexpected item kernel: %s", response.Results[2].Kernel)
+	}
+
+	res = batch(contentTypeNDJSON, body)
+	if res.Code != http.StatusOK || res.Header().Get("Content-Type") != contentTypeNDJSON {
+		t.Fatalf("unexpected response: %d %s", res.Code, res.Header().Get("Content-Type"))
+	}
+	seen := make(map[int]bool)
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		var result struct {
+			Index int `json:"index"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("failed to decode line: %v", err)
+		}
+		seen[result.Index] = true
+	}
+	if len(seen) != 4 {
+		t.Errorf("unexpected streamed results: %v", seen)
+	}
+
+	res = batch("", `[{}, {}, {}, {}, {}, {}]`)
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status of large batch: %d", res.Code)
+	}
+}
+
+func TestServerBatchLimit(t *testing.T) {
+	jupyter := jupytertest.NewServer("", jupytertest.Echo)
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+	err := LimitsConfig{Kernels: map[string]LimitConfig{
+		"python": {Rate: 0.1, Burst: 2, Concurrency: 1},
+	}}.Apply(srv)
+	if err != nil {
+		t.Fatalf("failed to apply limits: %v", err)
+	}
+
+	res := execute(srv, "/api/v1/batch", `[
+		{"kernel": "python", "code": "print(1)"},
+		{"kernel": "python", "code": "print(2)"},
+		{"kernel": "python", "code": "print(3)"}
+	]`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d %s", res.Code, res.Body)
+	}
+	var response struct {
+		Results []struct {
+			Error string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	limited := 0
+	for _, result := range response.Results {
+		switch {
+		case strings.Contains(result.Error, "rate limit"):
+			limited++
+		case result.Error != "":
+			t.Errorf("unexpected error: %s", result.Error)
+		}
+	}
+	if limited != 1 {
+		t.Errorf("unexpected number of limited items: %d", limited)
+	}
+
+	// The items used up the kernel limit of the client.
+	if res := execute(srv, "/api/v1/execute/python", "print(42)"); res.Code != http.StatusTooManyRequests {
+		t.Errorf("unexpected status of limited request: %d", res.Code)
+	}
+}
+
+func TestServerBatchGlobalLimit(t *testing.T) {
+	jupyter := jupytertest.NewServer("", jupytertest.Echo)
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+	err := LimitsConfig{LimitConfig: LimitConfig{Rate: 0.1, Burst: 2, Concurrency: 1}}.Apply(srv)
+	if err != nil {
+		t.Fatalf("failed to apply limits: %v", err)
+	}
+
+	res := execute(srv, "/api/v1/batch", `[
+		{"kernel": "python", "code": "print(1)"},
+		{"kernel": "python", "code": "print(2)"},
+		{"kernel": "python", "code": "print(3)"}
+	]`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d %s", res.Code, res.Body)
+	}
+	var response struct {
+		Results []struct {
+			Error string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	// Each item takes a global token, so the batch can't exceed the rate.
+	limited := 0
+	for _, result := range response.Results {
+		switch {
+		case strings.Contains(result.Error, "rate limit"):
+			limited++
+		case result.Error != "":
+			t.Errorf("unexpected error: %s", result.Error)
+		}
+	}
+	if limited != 1 {
+		t.Errorf("unexpected number of limited items: %d", limited)
+	}
+}
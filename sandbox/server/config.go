@@ -1,12 +1,82 @@
 package server
 
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
 // Config represents a configuration of the the sandbox management server.
 type Config struct {
-	Address string `json:"http" yaml:"http"`
+	Address    string        `json:"http" yaml:"http"`
+	RetryAfter time.Duration `json:"retry_after" yaml:"retry_after"`
+	Auth       AuthConfig    `json:"auth" yaml:"auth"`
+	Limits     LimitsConfig  `json:"limits" yaml:"limits"`
+	CORS       CORSConfig    `json:"cors" yaml:"cors"`
+	Webhooks   WebhookConfig `json:"webhooks" yaml:"webhooks"`
+	Batch      BatchConfig   `json:"batch" yaml:"batch"`
+}
+
+// AuthConfig represents a configuration of the request authentication. The
+// API is open to anonymous requests unless any method is configured.
+type AuthConfig struct {
+	// Keys are the static API keys.
+	Keys []APIKey `json:"keys,omitempty" yaml:"keys,omitempty"`
+	// KeysFile is a path to the yaml list of additional API keys.
+	KeysFile string `json:"keys_file,omitempty" yaml:"keys_file,omitempty"`
+	// JWT enables the token authentication.
+	JWT *JWTConfig `json:"jwt,omitempty" yaml:"jwt,omitempty"`
 }
 
 // Apply applies the configuration to the given server.
 func (cfg Config) Apply(srv *Server) error {
 	srv.addr = cfg.Address
+	if cfg.RetryAfter > 0 {
+		srv.retry = cfg.RetryAfter
+	}
+	return multierr.Combine(
+		cfg.Auth.Apply(srv),
+		cfg.Limits.Apply(srv),
+		cfg.CORS.Apply(srv),
+		cfg.Webhooks.Apply(srv),
+		cfg.Batch.Apply(srv),
+	)
+}
+
+// Apply applies the authentication configuration to the given server.
+func (cfg AuthConfig) Apply(srv *Server) error {
+	var errs []error
+
+	keys := cfg.Keys
+	if cfg.KeysFile != "" {
+		file, err := ReadAPIKeys(cfg.KeysFile)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		keys = append(keys[:len(keys):len(keys)], file...)
+	}
+	if len(keys) > 0 {
+		auth, err := NewAPIKeys(keys...)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			srv.auth = append(srv.auth, auth)
+		}
+	}
+
+	if cfg.JWT != nil {
+		auth, err := NewJWT(*cfg.JWT)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			srv.auth = append(srv.auth, auth)
+		}
+	}
+
+	err := multierr.Combine(errs...)
+	if err != nil {
+		return fmt.Errorf("invalid auth configuration: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"golang.org/x/net/websocket"
+
+	"github.com/uclatall/ckhub/pkg/logging"
+	"github.com/uclatall/ckhub/sandbox"
+)
+
+// Well-known types of the console client messages.
+const (
+	consoleExecute = "execute"
+	consoleInput   = "input"
+)
+
+// Well-known names of the console events, besides the output kinds.
+const (
+	eventInputRequest = "input_request"
+)
+
+// consoleMessage represents a message sent by the console client.
+type consoleMessage struct {
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+	Timeout string `json:"timeout,omitempty"`
+	Value   string `json:"value,omitempty"`
+
+	UserExpressions map[string]string `json:"user_expressions,omitempty"`
+}
+
+// consoleEvent represents an event sent to the console client.
+type consoleEvent struct {
+	Event string `json:"event"`
+	Data  any    `json:"data"`
+}
+
+// consoleInputRequest represents a request for the user input.
+type consoleInputRequest struct {
+	Prompt   string `json:"prompt"`
+	Password bool   `json:"password"`
+}
+
+// Console serves an interactive console over the websocket connection. The
+// client sends execute messages with the code, receives outputs as soon as
+// they arrive, and answers input requests of the kernel with input messages.
+// Each execution is subject to the client limits.
+func (srv *Server) Console(w http.ResponseWriter, req *http.Request) {
+	kernel := strings.ToLower(chi.URLParam(req, "kernel"))
+	if !authorize(w, req, kernel) {
+		return
+	}
+	key := srv.clientKey(req)
+
+	server := websocket.Server{
+		Handler: func(conn *websocket.Conn) {
+			srv.serveConsole(conn, key, kernel)
+		},
+	}
+	server.ServeHTTP(w, req)
+}
+
+func (srv *Server) serveConsole(conn *websocket.Conn, key, kernel string) {
+	log := srv.log.Hooks(logging.Span()).Fields(logging.String("kernel", kernel))
+	defer func() { _ = conn.Close() }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages := make(chan consoleMessage)
+	go func() {
+		defer cancel()
+		defer close(messages)
+
+		for {
+			var msg consoleMessage
+			err := websocket.JSON.Receive(conn, &msg)
+			if err != nil {
+				return
+			}
+
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	console := &console{conn: conn, messages: messages, log: log}
+
+	for msg := range messages {
+		if msg.Type != consoleExecute {
+			log.Debug("unexpected message", logging.String("type", msg.Type))
+			continue
+		}
+
+		var timeout time.Duration
+		if msg.Timeout != "" {
+			var err error
+			timeout, err = time.ParseDuration(msg.Timeout)
+			if err != nil {
+				console.Send(eventStatus, streamStatus{
+					Message: fmt.Sprintf("invalid timeout: %s", err),
+				})
+				continue
+			}
+		}
+
+		release, _, err := srv.acquire(key, kernel)
+		if err != nil {
+			console.Send(eventStatus, streamStatus{Message: err.Error()})
+			continue
+		}
+
+		id := uuid.New()
+		result, err := srv.manager.ExecuteSnippet(ctx, &sandbox.Snippet{
+			ID:      id,
+			Kernel:  kernel,
+			Source:  msg.Code,
+			Timeout: timeout,
+			Handler: console,
+			Input:   console,
+
+			UserExpressions: msg.UserExpressions,
+		})
+		release()
+		if err != nil {
+			log.Warn(
+				"failed to execute snippet",
+				logging.Stringer("trace", id),
+				logging.Error(err),
+			)
+			console.Send(eventStatus, streamStatus{Message: err.Error()})
+			continue
+		}
+		log.Debug(
+			"execution complete",
+			logging.Stringer("trace", id),
+			logging.String("status", result.Status),
+		)
+
+		console.Send(eventStatus, streamStatus{
+			Status:          result.Status,
+			UserExpressions: result.UserExpressions,
+		})
+	}
+
+	if err := console.Err(); err != nil {
+		log.Error("failed to write response", logging.Error(err))
+	}
+}
+
+// ErrConsoleClosed is returned when the console connection is closed.
+var ErrConsoleClosed = errors.New("console closed")
+
+// console implements the execution handler and input over the websocket
+// connection.
+type console struct {
+	conn     *websocket.Conn
+	messages <-chan consoleMessage
+	log      logging.Logger
+	err      error
+}
+
+// Handle sends the given execution event to the client.
+func (c *console) Handle(event sandbox.Event) {
+	switch event.Kind {
+	case sandbox.EventKindOutput:
+		c.Send(event.Output.Kind.String(), event.Output)
+	case sandbox.EventKindError:
+		c.Send(eventError, event.Error)
+	case sandbox.EventKindClearOutput:
+		c.Send(eventClearOutput, struct{}{})
+	}
+}
+
+// ReadInput requests the user input from the client and waits for the reply.
+func (c *console) ReadInput(
+	ctx context.Context,
+	prompt string,
+	password bool,
+) (string, error) {
+	c.Send(eventInputRequest, consoleInputRequest{
+		Prompt:   prompt,
+		Password: password,
+	})
+	if c.err != nil {
+		return "", c.err
+	}
+
+	for {
+		select {
+		case msg, ok := <-c.messages:
+			if !ok {
+				return "", ErrConsoleClosed
+			}
+			if msg.Type == consoleInput {
+				return msg.Value, nil
+			}
+			c.log.Debug("unexpected message", logging.String("type", msg.Type))
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// Send sends an event with the given name and data to the client.
+func (c *console) Send(name string, data any) {
+	if c.err != nil {
+		return
+	}
+
+	err := websocket.JSON.Send(c.conn, consoleEvent{Event: name, Data: data})
+	if err != nil {
+		c.err = fmt.Errorf("failed to write event: %w", err)
+	}
+}
+
+// Err returns the first error occurred while writing to the client.
+func (c *console) Err() error {
+	return c.err
+}
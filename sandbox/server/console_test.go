@@ -0,0 +1,153 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+	"github.com/uclatall/ckhub/sandbox"
+)
+
+// testConsoleEvent represents a decoded console event.
+type testConsoleEvent struct {
+	Event string         `json:"event"`
+	Data  map[string]any `json:"data"`
+}
+
+// dialConsole connects to the console of the given kernel.
+func dialConsole(t *testing.T, srv *Server, kernel string) *websocket.Conn {
+	t.Helper()
+
+	server := httptest.NewServer(srv.mux)
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/execute/" + kernel + "/console"
+	conn, err := websocket.Dial(url, "", server.URL)
+	if err != nil {
+		t.Fatalf("failed to connect console: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	err = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+	return conn
+}
+
+// readConsole reads console events until the final status event.
+func readConsole(t *testing.T, conn *websocket.Conn) []testConsoleEvent {
+	t.Helper()
+
+	var events []testConsoleEvent
+	for {
+		var event testConsoleEvent
+		err := websocket.JSON.Receive(conn, &event)
+		if err != nil {
+			t.Fatalf("failed to read event: %v", err)
+		}
+		events = append(events, event)
+		if event.Event == eventStatus {
+			return events
+		}
+	}
+}
+
+func TestServerConsole(t *testing.T) {
+	jupyter := jupytertest.NewServer("", func(code string) jupytertest.Reply {
+		if code == "input()" {
+			return jupytertest.Reply{
+				Outputs: []jupytertest.Output{jupytertest.InputRequest("name: ")},
+			}
+		}
+		return jupytertest.Echo(code)
+	})
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+	conn := dialConsole(t, srv, "Python")
+
+	send := func(msg consoleMessage) {
+		t.Helper()
+
+		err := websocket.JSON.Send(conn, msg)
+		if err != nil {
+			t.Fatalf("failed to send message: %v", err)
+		}
+	}
+
+	send(consoleMessage{Type: consoleExecute, Code: "print(1)"})
+	events := readConsole(t, conn)
+	if len(events) != 2 || events[0].Event != "stream" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if data, _ := events[0].Data["data"].(map[string]any); data["text"] != "print(1)" {
+		t.Errorf("unexpected stream event: %v", events[0].Data)
+	}
+	if status := events[1].Data["status"]; status != sandbox.StatusOK {
+		t.Errorf("unexpected status: %v", status)
+	}
+
+	send(consoleMessage{Type: consoleExecute, Code: "input()"})
+	var request testConsoleEvent
+	err := websocket.JSON.Receive(conn, &request)
+	if err != nil {
+		t.Fatalf("failed to read event: %v", err)
+	}
+	if request.Event != eventInputRequest || request.Data["prompt"] != "name: " {
+		t.Fatalf("unexpected input request: %+v", request)
+	}
+	send(consoleMessage{Type: consoleInput, Value: "ckhub"})
+	events = readConsole(t, conn)
+	if len(events) != 2 || events[0].Event != "stream" {
+		t.Fatalf("unexpected events after input: %+v", events)
+	}
+	if data, _ := events[0].Data["data"].(map[string]any); data["text"] != "ckhub" {
+		t.Errorf("unexpected echoed input: %v", events[0].Data)
+	}
+
+	send(consoleMessage{Type: consoleExecute, Code: "print(1)", Timeout: "soon"})
+	events = readConsole(t, conn)
+	if message, _ := events[0].Data["message"].(string); !strings.HasPrefix(message, "invalid timeout") {
+		t.Errorf("unexpected status of invalid timeout: %+v", events)
+	}
+}
+
+func TestServerConsoleLimit(t *testing.T) {
+	jupyter := jupytertest.NewServer("", jupytertest.Echo)
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+	err := LimitsConfig{Kernels: map[string]LimitConfig{
+		"python": {Rate: 0.1, Burst: 1},
+	}}.Apply(srv)
+	if err != nil {
+		t.Fatalf("failed to apply limits: %v", err)
+	}
+
+	conn := dialConsole(t, srv, "python")
+
+	execute := func() testConsoleEvent {
+		t.Helper()
+
+		err := websocket.JSON.Send(conn, consoleMessage{Type: consoleExecute, Code: "print(1)"})
+		if err != nil {
+			t.Fatalf("failed to send message: %v", err)
+		}
+		events := readConsole(t, conn)
+		return events[len(events)-1]
+	}
+
+	// The connection itself takes no token, and each execution takes one.
+	if status := execute(); status.Data["status"] != sandbox.StatusOK {
+		t.Errorf("unexpected status of first execution: %+v", status)
+	}
+	status := execute()
+	if message, _ := status.Data["message"].(string); !strings.HasPrefix(message, "too many requests") {
+		t.Errorf("unexpected status of limited execution: %+v", status)
+	}
+}
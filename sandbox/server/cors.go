@@ -0,0 +1,214 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig represents a configuration of the cross-origin requests to the
+// API. Cross-origin requests are not handled unless origins are set.
+type CORSConfig struct {
+	// Origins are the allowed origins, such as https://example.org. An origin
+	// can match subdomains with a wildcard (https://*.example.org), and the
+	// single * allows any origin.
+	Origins []string `json:"origins,omitempty" yaml:"origins,omitempty"`
+	// Methods are the allowed request methods.
+	Methods []string `json:"methods,omitempty" yaml:"methods,omitempty"`
+	// Headers are the allowed request headers.
+	Headers []string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// ExposeHeaders are the response headers available to the clients.
+	ExposeHeaders []string `json:"expose_headers,omitempty" yaml:"expose_headers,omitempty"`
+	// Credentials allows requests with cookies and authorization.
+	Credentials bool `json:"credentials,omitempty" yaml:"credentials,omitempty"`
+	// MaxAge is the time the preflight response can be cached.
+	MaxAge time.Duration `json:"max_age,omitempty" yaml:"max_age,omitempty"`
+}
+
+// ErrInvalidCORS is returned when the CORS configuration is invalid.
+var ErrInvalidCORS = errors.New("invalid cors configuration")
+
+// ErrOriginNotAllowed is returned when the request origin is not allowed.
+var ErrOriginNotAllowed = errors.New("origin not allowed")
+
+// corsPrefix is the path prefix of the routes available to the cross-origin
+// requests.
+const corsPrefix = "/api/v1/"
+
+// cors represents a policy of the cross-origin requests.
+type cors struct {
+	any      bool
+	origins  map[string]bool
+	patterns []originPattern
+
+	methods     map[string]bool
+	headers     map[string]bool
+	credentials bool
+
+	allowMethods  string
+	allowHeaders  string
+	exposeHeaders string
+	maxAge        string
+}
+
+// originPattern matches the subdomains of the host with the given scheme.
+type originPattern struct {
+	scheme string
+	suffix string
+}
+
+// Apply applies the CORS configuration to the given server.
+func (cfg CORSConfig) Apply(srv *Server) error {
+	if len(cfg.Origins) == 0 {
+		srv.cors = nil
+		return nil
+	}
+
+	methods := cfg.Methods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodPost, http.MethodDelete}
+	}
+	headers := cfg.Headers
+	if len(headers) == 0 {
+		headers = []string{"Accept", "Authorization", "Content-Type", "X-API-Key"}
+	}
+	expose := cfg.ExposeHeaders
+	if len(expose) == 0 {
+		expose = []string{"Retry-After"}
+	}
+
+	policy := &cors{
+		origins:     make(map[string]bool, len(cfg.Origins)),
+		methods:     make(map[string]bool, len(methods)),
+		headers:     make(map[string]bool, len(headers)),
+		credentials: cfg.Credentials,
+
+		allowHeaders:  strings.Join(headers, ", "),
+		exposeHeaders: strings.Join(expose, ", "),
+	}
+
+	for _, origin := range cfg.Origins {
+		switch {
+		case origin == "*":
+			if cfg.Credentials {
+				return fmt.Errorf("%w: any origin is not allowed with credentials", ErrInvalidCORS)
+			}
+			policy.any = true
+		case strings.Contains(origin, "*"):
+			scheme, host, ok := strings.Cut(origin, "://*.")
+			if !ok || scheme == "" || host == "" || strings.Contains(host, "*") {
+				return fmt.Errorf("%w: invalid origin %q", ErrInvalidCORS, origin)
+			}
+			policy.patterns = append(policy.patterns, originPattern{
+				scheme: strings.ToLower(scheme),
+				suffix: "." + strings.ToLower(host),
+			})
+		default:
+			policy.origins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+		}
+	}
+
+	allowed := make([]string, len(methods))
+	for i, method := range methods {
+		allowed[i] = strings.ToUpper(method)
+		policy.methods[allowed[i]] = true
+	}
+	policy.allowMethods = strings.Join(allowed, ", ")
+
+	for _, header := range headers {
+		policy.headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	if cfg.MaxAge > 0 {
+		policy.maxAge = strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+
+	srv.cors = policy
+	return nil
+}
+
+// allows returns true if the given origin is allowed.
+func (c *cors) allows(origin string) bool {
+	if c.any {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if c.origins[origin] {
+		return true
+	}
+
+	uri, err := url.Parse(origin)
+	if err != nil || uri.Host == "" {
+		return false
+	}
+	for _, pattern := range c.patterns {
+		if uri.Scheme == pattern.scheme && strings.HasSuffix(uri.Host, pattern.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleCORS answers the preflight requests and sets the CORS headers of the
+// cross-origin requests to the API. Requests of unknown origins are refused.
+func (srv *Server) handleCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get("Origin")
+		if srv.cors == nil || origin == "" || !strings.HasPrefix(req.URL.Path, corsPrefix) {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		policy := srv.cors
+		header := w.Header()
+		header.Add("Vary", "Origin")
+
+		if !policy.allows(origin) {
+			writeError(w, http.StatusForbidden, ErrOriginNotAllowed)
+			return
+		}
+
+		if policy.any {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if policy.credentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		method := req.Header.Get("Access-Control-Request-Method")
+		if req.Method != http.MethodOptions || method == "" {
+			header.Set("Access-Control-Expose-Headers", policy.exposeHeaders)
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+
+		if !policy.methods[strings.ToUpper(method)] {
+			writeError(w, http.StatusForbidden, fmt.Errorf("method %s not allowed", method))
+			return
+		}
+		for _, name := range strings.Split(req.Header.Get("Access-Control-Request-Headers"), ",") {
+			name = strings.TrimSpace(name)
+			if name != "" && !policy.headers[http.CanonicalHeaderKey(name)] {
+				writeError(w, http.StatusForbidden, fmt.Errorf("header %s not allowed", name))
+				return
+			}
+		}
+
+		header.Set("Access-Control-Allow-Methods", policy.allowMethods)
+		header.Set("Access-Control-Allow-Headers", policy.allowHeaders)
+		if policy.maxAge != "" {
+			header.Set("Access-Control-Max-Age", policy.maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
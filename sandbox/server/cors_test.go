@@ -0,0 +1,132 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+)
+
+func TestCORSConfig(t *testing.T) {
+	for _, origins := range [][]string{
+		{"https://*"},
+		{"*.example.org"},
+		{"https://*.*.example.org"},
+	} {
+		err := CORSConfig{Origins: origins}.Apply(&Server{})
+		if !errors.Is(err, ErrInvalidCORS) {
+			t.Errorf("unexpected error of %v: %v", origins, err)
+		}
+	}
+
+	err := CORSConfig{Origins: []string{"*"}, Credentials: true}.Apply(&Server{})
+	if !errors.Is(err, ErrInvalidCORS) {
+		t.Errorf("unexpected error of any origin with credentials: %v", err)
+	}
+
+	srv := &Server{}
+	err = CORSConfig{Origins: []string{"https://app.example.org/", "https://*.example.com"}}.Apply(srv)
+	if err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+
+	for origin, allowed := range map[string]bool{
+		"https://app.example.org":    true,
+		"https://APP.example.org":    true,
+		"http://app.example.org":     false,
+		"https://evil.example.org":   false,
+		"https://a.example.com":      true,
+		"https://a.b.example.com":    true,
+		"https://a.example.com:8443": false,
+		"https://example.com":        false,
+		"https://evilexample.com":    false,
+		"http://a.example.com":       false,
+		"null":                       false,
+	} {
+		if srv.cors.allows(origin) != allowed {
+			t.Errorf("unexpected result of %s: %v", origin, !allowed)
+		}
+	}
+}
+
+func TestServerCORS(t *testing.T) {
+	jupyter := jupytertest.NewServer("", nil)
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+	err := CORSConfig{
+		Origins:     []string{"https://*.example.org"},
+		Credentials: true,
+		MaxAge:      10 * time.Minute,
+	}.Apply(srv)
+	if err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+
+	preflight := func(origin, method, headers string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, "/api/v1/execute/python", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+		req.Header.Set("Access-Control-Request-Headers", headers)
+		res := httptest.NewRecorder()
+		srv.mux.ServeHTTP(res, req)
+		return res
+	}
+
+	res := preflight("https://app.example.org", "POST", "content-type, authorization")
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status of preflight: %d %s", res.Code, res.Body)
+	}
+	for name, value := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.org",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST, DELETE",
+		"Access-Control-Max-Age":           "600",
+	} {
+		if got := res.Header().Get(name); got != value {
+			t.Errorf("unexpected %s: %q", name, got)
+		}
+	}
+	if !strings.Contains(res.Header().Get("Access-Control-Allow-Headers"), "Authorization") {
+		t.Errorf("unexpected allowed headers: %q", res.Header().Get("Access-Control-Allow-Headers"))
+	}
+
+	if res = preflight("https://example.com", "POST", ""); res.Code != http.StatusForbidden {
+		t.Errorf("unexpected status of unknown origin: %d", res.Code)
+	}
+	if res = preflight("https://app.example.org", "PUT", ""); res.Code != http.StatusForbidden {
+		t.Errorf("unexpected status of unknown method: %d", res.Code)
+	}
+	if res = preflight("https://app.example.org", "POST", "X-Custom"); res.Code != http.StatusForbidden {
+		t.Errorf("unexpected status of unknown header: %d", res.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/execute/python", strings.NewReader("print(42)"))
+	req.Header.Set("Origin", "https://app.example.org")
+	res = httptest.NewRecorder()
+	srv.mux.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d %s", res.Code, res.Body)
+	}
+	if got := res.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.org" {
+		t.Errorf("unexpected allowed origin: %q", got)
+	}
+	if got := res.Header().Get("Access-Control-Expose-Headers"); got != "Retry-After" {
+		t.Errorf("unexpected exposed headers: %q", got)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/execute/python", strings.NewReader("print(42)"))
+	req.Header.Set("Origin", "https://example.com")
+	res = httptest.NewRecorder()
+	srv.mux.ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Errorf("unexpected status of unknown origin: %d", res.Code)
+	}
+	if got := res.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("unexpected allowed origin: %q", got)
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/uclatall/ckhub/pkg/logging"
+	"github.com/uclatall/ckhub/sandbox"
+)
+
+// CreateJob queues the code for the asynchronous execution, and returns the
+// job status at once. The request body is the same as for Execute.
+func (srv *Server) CreateJob(w http.ResponseWriter, req *http.Request) {
+	log := srv.log.Hooks(logging.Span()).Fields(principalFields(req)...)
+
+	snippet, err := readSnippet(req)
+	if err != nil {
+		log.Error("failed to read request", logging.Error(err))
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	log = log.Fields(logging.String("kernel", snippet.Kernel))
+	if !authorize(w, req, snippet.Kernel) {
+		log.Warn("execution forbidden")
+		return
+	}
+	if snippet.Callback != "" {
+		if err := srv.webhooks.allows(snippet.Callback); err != nil {
+			log.Warn("callback rejected", logging.Error(err))
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	release, ok := srv.limit(w, req, snippet.Kernel)
+	if !ok {
+		return
+	}
+
+	job, err := srv.manager.SubmitJob(owner(req), snippet)
+	if err != nil {
+		release()
+		if errors.Is(err, sandbox.ErrTooManyJobs) {
+			log.Warn("job rejected", logging.Error(err))
+			srv.writeRetry(w, http.StatusTooManyRequests, err)
+			return
+		}
+		srv.writeExecuteError(w, log, err)
+		return
+	}
+	log = log.Fields(logging.Stringer("job", job.ID()))
+	var cb *callback
+	if snippet.Callback != "" {
+		cb = srv.register(job, snippet.Callback)
+	}
+	// The client keeps its execution slots until the job is finished.
+	go func() {
+		<-job.Done()
+		release()
+		if cb != nil {
+			srv.deliver(log, job, cb)
+		}
+	}()
+	log.Debug("job created")
+
+	w.Header().Set("Location", "/api/v1/jobs/"+job.ID().String())
+	srv.writeJob(w, log, http.StatusAccepted, job)
+}
+
+// GetJob returns the job status, along with the result of the finished job.
+func (srv *Server) GetJob(w http.ResponseWriter, req *http.Request) {
+	_ = req.Body.Close()
+
+	job, ok := srv.authorizeJob(w, req)
+	if !ok {
+		return
+	}
+	srv.writeJob(w, srv.log, http.StatusOK, job)
+}
+
+// CancelJob cancels the job, interrupting its execution if it's running.
+func (srv *Server) CancelJob(w http.ResponseWriter, req *http.Request) {
+	_ = req.Body.Close()
+
+	job, ok := srv.authorizeJob(w, req)
+	if !ok {
+		return
+	}
+
+	err := job.Cancel()
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	srv.log.Debug("job cancelled", logging.Stringer("job", job.ID()))
+
+	srv.writeJob(w, srv.log, http.StatusAccepted, job)
+}
+
+// authorizeJob returns the job of the request if it's owned by the principal,
+// who is still permitted to use its kernel, and writes the error response
+// otherwise. The jobs of other principals are reported as missing.
+func (srv *Server) authorizeJob(w http.ResponseWriter, req *http.Request) (*sandbox.Job, bool) {
+	id, err := uuid.Parse(chi.URLParam(req, "id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, sandbox.ErrJobNotFound)
+		return nil, false
+	}
+	job, err := srv.manager.Job(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return nil, false
+	}
+	if job.Owner() != owner(req) {
+		writeError(w, http.StatusNotFound, sandbox.ErrJobNotFound)
+		return nil, false
+	}
+	return job, authorize(w, req, job.Kernel())
+}
+
+// jobResponse represents a status of the job along with its callback.
+type jobResponse struct {
+	sandbox.JobStatus
+	Callback *CallbackStatus `json:"callback,omitempty"`
+}
+
+func (srv *Server) writeJob(w http.ResponseWriter, log logging.Logger, code int, job *sandbox.Job) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	err := json.NewEncoder(w).Encode(jobResponse{
+		JobStatus: job.Status(),
+		Callback:  srv.callbackStatus(job.ID()),
+	})
+	if err != nil {
+		log.Error("failed to write response", logging.Error(err))
+	}
+}
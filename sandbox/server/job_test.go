@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+	"github.com/uclatall/ckhub/sandbox"
+)
+
+// testJob represents a decoded job status.
+type testJob struct {
+	ID     uuid.UUID        `json:"id"`
+	State  sandbox.JobState `json:"state"`
+	Result *struct {
+		Status  string           `json:"status"`
+		Outputs []map[string]any `json:"outputs"`
+	} `json:"result"`
+}
+
+func TestServerJobs(t *testing.T) {
+	jupyter := jupytertest.NewServer("", jupytertest.Echo)
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+
+	request := func(method, path string) (*httptest.ResponseRecorder, testJob) {
+		req := httptest.NewRequest(method, path, nil)
+		res := httptest.NewRecorder()
+		srv.mux.ServeHTTP(res, req)
+
+		var status testJob
+		if res.Code < http.StatusBadRequest {
+			if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+				t.Fatalf("failed to decode status: %v", err)
+			}
+		}
+		return res, status
+	}
+
+	res := execute(srv, "/api/v1/jobs/python", "print(42)")
+	if res.Code != http.StatusAccepted {
+		t.Fatalf("unexpected status: %d %s", res.Code, res.Body)
+	}
+	var created testJob
+	if err := json.NewDecoder(res.Body).Decode(&created); err != nil {
+		t.Fatalf("failed to decode status: %v", err)
+	}
+	location := res.Header().Get("Location")
+	if location != "/api/v1/jobs/"+created.ID.String() {
+		t.Errorf("unexpected location: %q", location)
+	}
+
+	var status testJob
+	deadline := time.Now().Add(5 * time.Second)
+	for !status.State.Final() {
+		if time.Now().After(deadline) {
+			t.Fatalf("job is not finished: %s", status.State)
+		}
+		time.Sleep(10 * time.Millisecond)
+		res, status = request(http.MethodGet, location)
+		if res.Code != http.StatusOK {
+			t.Fatalf("unexpected status: %d %s", res.Code, res.Body)
+		}
+	}
+	if status.State != sandbox.JobDone || status.Result == nil || len(status.Result.Outputs) != 1 {
+		t.Errorf("unexpected job status: %+v", status)
+	}
+
+	if res, _ = request(http.MethodDelete, location); res.Code != http.StatusConflict {
+		t.Errorf("unexpected status of finished job cancel: %d", res.Code)
+	}
+	if res, _ = request(http.MethodGet, "/api/v1/jobs/"+uuid.NewString()); res.Code != http.StatusNotFound {
+		t.Errorf("unexpected status of unknown job: %d", res.Code)
+	}
+	if res = execute(srv, "/api/v1/jobs/ir", "print(42)"); res.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status of unknown kernel: %d", res.Code)
+	}
+}
+
+func TestServerJobOwner(t *testing.T) {
+	jupyter := jupytertest.NewServer("", jupytertest.Echo)
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+	err := Config{Auth: AuthConfig{Keys: []APIKey{
+		{Label: "alice", Hash: hashKey("a"), Kernels: []string{"python"}},
+		{Label: "bob", Hash: hashKey("b"), Kernels: []string{"python"}},
+	}}}.Apply(srv)
+	if err != nil {
+		t.Fatalf("failed to configure auth: %v", err)
+	}
+
+	request := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		res := httptest.NewRecorder()
+		srv.mux.ServeHTTP(res, req)
+		return res
+	}
+
+	id := uuid.New()
+	res := request(http.MethodPost, "/api/v1/jobs/python", "a", `{"id": "`+id.String()+`", "code": "print(42)"}`)
+	if res.Code != http.StatusAccepted {
+		t.Fatalf("unexpected status: %d %s", res.Code, res.Body)
+	}
+	var created testJob
+	if err := json.NewDecoder(res.Body).Decode(&created); err != nil {
+		t.Fatalf("failed to decode status: %v", err)
+	}
+	if created.ID == id {
+		t.Error("job identifier is chosen by the client")
+	}
+	location := "/api/v1/jobs/" + created.ID.String()
+
+	if res := request(http.MethodGet, location, "b", ""); res.Code != http.StatusNotFound {
+		t.Errorf("unexpected status of foreign job: %d", res.Code)
+	}
+	if res := request(http.MethodDelete, location, "b", ""); res.Code != http.StatusNotFound {
+		t.Errorf("unexpected status of foreign job cancel: %d", res.Code)
+	}
+	if res := request(http.MethodGet, location, "a", ""); res.Code != http.StatusOK {
+		t.Errorf("unexpected status of own job: %d %s", res.Code, res.Body)
+	}
+}
@@ -0,0 +1,268 @@
+package server
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// JWTConfig represents a configuration of the token authentication. Tokens
+// are signed either with HS256 using the shared secret, or with RS256 using
+// the private key of the given public one. Tokens must expire, and permit the
+// kernels listed in their kernels claim only.
+type JWTConfig struct {
+	Secret        string        `json:"secret,omitempty" yaml:"secret,omitempty"`
+	PublicKeyFile string        `json:"public_key_file,omitempty" yaml:"public_key_file,omitempty"`
+	Issuer        string        `json:"issuer,omitempty" yaml:"issuer,omitempty"`
+	Audience      string        `json:"audience,omitempty" yaml:"audience,omitempty"`
+	KernelsClaim  string        `json:"kernels_claim,omitempty" yaml:"kernels_claim,omitempty"`
+	Leeway        time.Duration `json:"leeway,omitempty" yaml:"leeway,omitempty"`
+}
+
+// ErrInvalidJWTConfig is returned when the token authentication is
+// misconfigured.
+var ErrInvalidJWTConfig = errors.New("invalid jwt configuration")
+
+// JWT authenticates requests with signed bearer tokens.
+type JWT struct {
+	secret   []byte
+	key      *rsa.PublicKey
+	issuer   string
+	audience string
+	claim    string
+	leeway   time.Duration
+
+	now func() time.Time
+}
+
+// NewJWT creates a token authenticator with the given configuration.
+func NewJWT(cfg JWTConfig) (*JWT, error) {
+	auth := &JWT{
+		secret:   []byte(cfg.Secret),
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		claim:    cfg.KernelsClaim,
+		leeway:   cfg.Leeway,
+		now:      time.Now,
+	}
+	if auth.claim == "" {
+		auth.claim = "kernels"
+	}
+
+	if cfg.PublicKeyFile != "" {
+		//nolint:gosec // Reads the public key from the configured path.
+		data, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key: %w", err)
+		}
+		auth.key, err = parsePublicKey(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(auth.secret) == 0 && auth.key == nil {
+		return nil, fmt.Errorf("%w: secret or public key is required", ErrInvalidJWTConfig)
+	}
+	return auth, nil
+}
+
+// parsePublicKey parses the PEM encoded RSA public key.
+func parsePublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: public key is not PEM encoded", ErrInvalidJWTConfig)
+	}
+
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJWTConfig, err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: public key is not RSA", ErrInvalidJWTConfig)
+	}
+	return rsaKey, nil
+}
+
+// isJWT returns true if the given token is shaped as a compact JWT.
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// jwtClaims are the registered claims verified by the authenticator.
+type jwtClaims struct {
+	Issuer    string      `json:"iss"`
+	Audience  jwtAudience `json:"aud"`
+	ExpiresAt *int64      `json:"exp"`
+	NotBefore *int64      `json:"nbf"`
+}
+
+// jwtAudience is the audience claim, either a string or a list of strings.
+type jwtAudience []string
+
+// UnmarshalJSON decodes the audience claim.
+func (aud *jwtAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*aud = jwtAudience{single}
+		return nil
+	}
+	var list []string
+	err := json.Unmarshal(data, &list)
+	if err != nil {
+		return err
+	}
+	*aud = list
+	return nil
+}
+
+// Authenticate returns the principal of the bearer token of the request.
+func (auth *JWT) Authenticate(req *http.Request) (*Principal, error) {
+	token := credentials(req)
+	if !isJWT(token) {
+		return nil, nil
+	}
+
+	claims, err := auth.verify(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthorized, err)
+	}
+
+	kernels, err := claimKernels(claims[auth.claim])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s claim: %v", ErrUnauthorized, auth.claim, err)
+	}
+
+	subject, _ := claims["sub"].(string)
+	return &Principal{
+		Name:    subject,
+		Method:  MethodJWT,
+		Kernels: kernels,
+	}, nil
+}
+
+// verify checks the signature and the registered claims of the given token,
+// and returns all of its claims.
+func (auth *JWT) verify(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+
+	var header jwtHeader
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch {
+	case header.Alg == "HS256" && len(auth.secret) > 0:
+		mac := hmac.New(sha256.New, auth.secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, errors.New("signature mismatch")
+		}
+	case header.Alg == "RS256" && auth.key != nil:
+		digest := sha256.Sum256(signed)
+		err = rsa.VerifyPKCS1v15(auth.key, crypto.SHA256, digest[:], signature)
+		if err != nil {
+			return nil, errors.New("signature mismatch")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+
+	var registered jwtClaims
+	err = decodeSegment(parts[1], &registered)
+	if err != nil {
+		return nil, fmt.Errorf("invalid claims: %w", err)
+	}
+	var claims map[string]any
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return nil, fmt.Errorf("invalid claims: %w", err)
+	}
+
+	now := auth.now()
+	if registered.ExpiresAt == nil {
+		return nil, errors.New("token has no expiration")
+	}
+	if now.After(time.Unix(*registered.ExpiresAt, 0).Add(auth.leeway)) {
+		return nil, errors.New("token expired")
+	}
+	if registered.NotBefore != nil && now.Add(auth.leeway).Before(time.Unix(*registered.NotBefore, 0)) {
+		return nil, errors.New("token not valid yet")
+	}
+	if auth.issuer != "" && registered.Issuer != auth.issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", registered.Issuer)
+	}
+	if auth.audience != "" && !registered.Audience.contains(auth.audience) {
+		return nil, errors.New("unexpected audience")
+	}
+
+	return claims, nil
+}
+
+func (aud jwtAudience) contains(audience string) bool {
+	for _, a := range aud {
+		if a == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// claimKernels returns the kernels of the permission claim, which is either
+// a list of kernel names, or a space separated string. The missing claim
+// permits no kernels, and the "*" name permits all of them.
+func claimKernels(claim any) ([]string, error) {
+	switch claim := claim.(type) {
+	case nil:
+		return []string{}, nil
+	case string:
+		return strings.Fields(claim), nil
+	case []any:
+		kernels := make([]string, len(claim))
+		for i, k := range claim {
+			name, ok := k.(string)
+			if !ok {
+				return nil, errors.New("kernel name is not a string")
+			}
+			kernels[i] = name
+		}
+		return kernels, nil
+	default:
+		return nil, errors.New("unexpected type")
+	}
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
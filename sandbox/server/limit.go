@@ -0,0 +1,345 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uclatall/ckhub/pkg/logging"
+)
+
+// LimitsConfig represents a configuration of the per-client limits. The
+// global limits apply to the executions of a client across all kernels, and
+// the kernel limits to its executions of the kernel.
+type LimitsConfig struct {
+	LimitConfig `yaml:",inline"`
+
+	Kernels map[string]LimitConfig `json:"kernels,omitempty" yaml:"kernels,omitempty"`
+	// TrustedProxies are the addresses or networks of the proxies, which
+	// X-Forwarded-For header identifies the client.
+	TrustedProxies []string `json:"trusted_proxies,omitempty" yaml:"trusted_proxies,omitempty"`
+}
+
+// LimitConfig represents limits of the client executions. Zero values disable
+// the corresponding limit.
+type LimitConfig struct {
+	// Rate is the number of executions per second a client can make.
+	Rate float64 `json:"rate,omitempty" yaml:"rate,omitempty"`
+	// Burst is the number of executions a client can make at once, which
+	// defaults to the rate rounded up.
+	Burst uint `json:"burst,omitempty" yaml:"burst,omitempty"`
+	// Concurrency is the maximum number of concurrent executions of a client.
+	Concurrency uint `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+}
+
+// Apply applies the limits configuration to the given server.
+func (cfg LimitsConfig) Apply(srv *Server) error {
+	proxies := make([]*net.IPNet, 0, len(cfg.TrustedProxies))
+	for _, proxy := range cfg.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy: %w", err)
+		}
+		proxies = append(proxies, network)
+	}
+	srv.proxies = proxies
+
+	srv.limits.global = newLimiter(cfg.LimitConfig)
+	srv.limits.kernels = make(map[string]*limiter, len(cfg.Kernels))
+	for name, limit := range cfg.Kernels {
+		srv.limits.kernels[strings.ToLower(name)] = newLimiter(limit)
+	}
+	return nil
+}
+
+// limits contains the limiters of the server.
+type limits struct {
+	global   *limiter
+	kernels  map[string]*limiter
+	rejected int64
+}
+
+// limiter limits the executions of the clients with a token bucket and the
+// number of concurrent executions.
+type limiter struct {
+	rate        float64
+	burst       float64
+	concurrency int
+
+	mu      sync.Mutex
+	clients map[string]*bucket
+	pruned  time.Time
+}
+
+// bucket represents the state of a single client.
+type bucket struct {
+	tokens float64
+	last   time.Time
+	active int
+}
+
+// pruneInterval is the interval of the idle clients removal.
+const pruneInterval = time.Minute
+
+func newLimiter(cfg LimitConfig) *limiter {
+	if cfg.Rate <= 0 && cfg.Concurrency == 0 {
+		return nil
+	}
+
+	burst := float64(cfg.Burst)
+	if burst == 0 {
+		burst = math.Ceil(cfg.Rate)
+	}
+	return &limiter{
+		rate:        cfg.Rate,
+		burst:       burst,
+		concurrency: int(cfg.Concurrency),
+		clients:     make(map[string]*bucket),
+	}
+}
+
+// Well-known reasons of the rejected requests.
+const (
+	reasonRate        = "rate"
+	reasonConcurrency = "concurrency"
+)
+
+// acquire takes a token of the given client and a slot of its concurrent
+// executions. If the client exceeds any limit, it returns the reason and the
+// suggested delay before the next attempt, which is zero if it's unknown.
+func (l *limiter) acquire(key string, now time.Time) (string, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+
+	b, ok := l.clients[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.clients[key] = b
+	}
+
+	if l.rate > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+		b.last = now
+		if b.tokens < 1 {
+			delay := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+			return reasonRate, delay
+		}
+	}
+	if l.concurrency > 0 && b.active >= l.concurrency {
+		return reasonConcurrency, 0
+	}
+
+	if l.rate > 0 {
+		b.tokens--
+	}
+	b.active++
+	return "", 0
+}
+
+// release frees a slot of the concurrent executions of the given client.
+func (l *limiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.clients[key]; ok && b.active > 0 {
+		b.active--
+	}
+}
+
+// cancel reverts the acquisition of the given client, which is rejected by
+// another limiter.
+func (l *limiter) cancel(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.clients[key]; ok && b.active > 0 {
+		b.active--
+		if l.rate > 0 {
+			b.tokens = math.Min(l.burst, b.tokens+1)
+		}
+	}
+}
+
+// prune removes the clients, which buckets are full and have no executions.
+// The caller must hold the limiter lock.
+func (l *limiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < pruneInterval {
+		return
+	}
+	l.pruned = now
+
+	for key, b := range l.clients {
+		full := l.rate <= 0 || b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst
+		if full && b.active == 0 {
+			delete(l.clients, key)
+		}
+	}
+}
+
+// limit applies the global and the kernel limits to the client of the given
+// request. It returns a function releasing the execution slots, or writes
+// the rejection response and returns false.
+func (srv *Server) limit(w http.ResponseWriter, req *http.Request, kernel string) (func(), bool) {
+	release, delay, err := srv.acquire(srv.clientKey(req), kernel)
+	if err != nil {
+		if delay <= 0 {
+			delay = srv.retry
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+		writeError(w, http.StatusTooManyRequests, err)
+		return nil, false
+	}
+	return release, true
+}
+
+// acquire applies the global and the kernel limits to the client with the
+// given key. It returns a function releasing the execution slots, or the
+// rejection error along with the suggested delay before the next attempt.
+func (srv *Server) acquire(key, kernel string) (func(), time.Duration, error) {
+	release, reason, delay := srv.take(key, kernel)
+	if reason != "" {
+		return nil, delay, srv.reject(key, kernel, reason)
+	}
+	return release, 0, nil
+}
+
+// take takes the execution slots of the client with the given key from the
+// global and the kernel limiters, all or none of them. It returns a function
+// releasing the slots, or the reason of the rejection along with the
+// suggested delay before the next attempt.
+func (srv *Server) take(key, kernel string) (func(), string, time.Duration) {
+	limiters := make([]*limiter, 0, 2)
+	if srv.limits.global != nil {
+		limiters = append(limiters, srv.limits.global)
+	}
+	if l := srv.limits.kernels[kernel]; l != nil {
+		limiters = append(limiters, l)
+	}
+	if len(limiters) == 0 {
+		return func() {}, "", 0
+	}
+
+	now := time.Now()
+	for i, l := range limiters {
+		reason, delay := l.acquire(key, now)
+		if reason == "" {
+			continue
+		}
+		for _, acquired := range limiters[:i] {
+			acquired.cancel(key)
+		}
+		return nil, reason, delay
+	}
+
+	return func() {
+		for _, l := range limiters {
+			l.release(key)
+		}
+	}, "", 0
+}
+
+// limitPoll is the interval of the concurrency slot polling.
+const limitPoll = 100 * time.Millisecond
+
+// limitWait applies the global and the kernel limits to the client of the
+// given request. It waits for the slots of the concurrent executions, and
+// returns a function releasing them, or the error if the client exceeds the
+// rate.
+func (srv *Server) limitWait(req *http.Request, kernel string) (func(), error) {
+	key := srv.clientKey(req)
+	for {
+		release, reason, _ := srv.take(key, kernel)
+		switch reason {
+		case "":
+			return release, nil
+		case reasonConcurrency:
+			select {
+			case <-time.After(limitPoll):
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+		default:
+			return nil, srv.reject(key, kernel, reason)
+		}
+	}
+}
+
+// reject records the rejection of the client request, and returns its error.
+func (srv *Server) reject(key, kernel, reason string) error {
+	rejected := atomic.AddInt64(&srv.limits.rejected, 1)
+	srv.log.Warn(
+		"request limited",
+		logging.String("client", key),
+		logging.String("kernel", kernel),
+		logging.String("reason", reason),
+		logging.Int64("rejected", rejected),
+	)
+	return fmt.Errorf("too many requests: %s limit exceeded", reason)
+}
+
+// clientKey returns the key identifying the client of the given request: the
+// authenticated principal, or the client address.
+func (srv *Server) clientKey(req *http.Request) string {
+	if principal := PrincipalFromContext(req.Context()); principal != nil {
+		return principal.Method + ":" + principal.Name
+	}
+	return "ip:" + srv.clientIP(req)
+}
+
+// clientIP returns the address of the client. Requests of the trusted proxies
+// are attributed to the last untrusted address of the X-Forwarded-For chain.
+func (srv *Server) clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	if !srv.trusted(host) {
+		return host
+	}
+
+	var chain []string
+	for _, header := range req.Header.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(header, ",") {
+			chain = append(chain, strings.TrimSpace(addr))
+		}
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		if net.ParseIP(chain[i]) == nil {
+			break
+		}
+		host = chain[i]
+		if !srv.trusted(host) {
+			break
+		}
+	}
+	return host
+}
+
+// trusted returns true if the given address belongs to a trusted proxy.
+func (srv *Server) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range srv.proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	l := newLimiter(LimitConfig{Rate: 0.5, Burst: 2, Concurrency: 1})
+
+	if reason, _ := l.acquire("a", now); reason != "" {
+		t.Fatalf("first request is rejected: %s", reason)
+	}
+	if reason, _ := l.acquire("a", now); reason != reasonConcurrency {
+		t.Errorf("unexpected reason of concurrent request: %q", reason)
+	}
+	if reason, _ := l.acquire("b", now); reason != "" {
+		t.Errorf("request of another client is rejected: %s", reason)
+	}
+
+	l.release("a")
+	if reason, _ := l.acquire("a", now); reason != "" {
+		t.Fatalf("second request is rejected: %s", reason)
+	}
+	l.release("a")
+
+	reason, delay := l.acquire("a", now.Add(time.Second))
+	if reason != reasonRate || delay != time.Second {
+		t.Errorf("unexpected rejection: %q after %s", reason, delay)
+	}
+	if reason, _ := l.acquire("a", now.Add(2*time.Second)); reason != "" {
+		t.Errorf("request after refill is rejected: %s", reason)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	srv := &Server{}
+	err := LimitsConfig{TrustedProxies: []string{"10.0.0.0/8", "192.168.1.1"}}.Apply(srv)
+	if err != nil {
+		t.Fatalf("failed to apply limits: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		ip        string
+	}{
+		{name: "direct", remote: "203.0.113.7:5000", ip: "203.0.113.7"},
+		{name: "spoofed", remote: "203.0.113.7:5000", forwarded: "1.2.3.4", ip: "203.0.113.7"},
+		{name: "proxy", remote: "10.1.2.3:5000", forwarded: "1.2.3.4", ip: "1.2.3.4"},
+		{name: "chain", remote: "10.1.2.3:5000", forwarded: "6.6.6.6, 1.2.3.4, 192.168.1.1", ip: "1.2.3.4"},
+		{name: "garbage", remote: "10.1.2.3:5000", forwarded: "unknown", ip: "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if ip := srv.clientIP(req); ip != tt.ip {
+				t.Errorf("unexpected client ip: %s", ip)
+			}
+		})
+	}
+}
+
+func TestServerLimit(t *testing.T) {
+	jupyter := jupytertest.NewServer("", nil)
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+	err := LimitsConfig{Kernels: map[string]LimitConfig{
+		"Python": {Rate: 0.1, Burst: 1},
+	}}.Apply(srv)
+	if err != nil {
+		t.Fatalf("failed to apply limits: %v", err)
+	}
+
+	res := execute(srv, "/api/v1/execute/python", "print(42)")
+	if res.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d %s", res.Code, res.Body)
+	}
+
+	res = execute(srv, "/api/v1/execute/python", "print(42)")
+	if res.Code != http.StatusTooManyRequests {
+		t.Fatalf("unexpected status of limited request: %d", res.Code)
+	}
+	if retry := res.Header().Get("Retry-After"); retry != "10" {
+		t.Errorf("unexpected Retry-After: %q", retry)
+	}
+}
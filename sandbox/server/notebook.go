@@ -0,0 +1,314 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/uclatall/ckhub/pkg/jupyter"
+	"github.com/uclatall/ckhub/pkg/logging"
+	"github.com/uclatall/ckhub/pkg/nbformat"
+	"github.com/uclatall/ckhub/sandbox"
+)
+
+const contentTypeNotebook = "application/x-ipynb+json"
+
+// defaultSkipTag is the tag of the cells skipped by default.
+const defaultSkipTag = "skip-execution"
+
+// ErrNotebookKernel is returned when the kernel of the notebook is unknown.
+var ErrNotebookKernel = errors.New("notebook kernel is not set")
+
+// notebookOptions represents options of the notebook execution.
+type notebookOptions struct {
+	stop    bool
+	timeout time.Duration
+	skip    []string
+}
+
+// ExecuteNotebook executes the code cells of the nbformat v4 notebook one
+// after another in a single kernel instance, and returns the notebook with
+// their outputs and execution counts. The kernel is taken from the URL, or
+// from the kernelspec of the notebook metadata.
+func (srv *Server) ExecuteNotebook(w http.ResponseWriter, req *http.Request) {
+	log := srv.log.Hooks(logging.Span()).Fields(principalFields(req)...)
+
+	notebook, options, err := readNotebook(req)
+	if err != nil {
+		log.Error("failed to read request", logging.Error(err))
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	kernel, err := srv.notebookKernel(req, notebook)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	log = log.Fields(logging.String("kernel", kernel))
+	if !authorize(w, req, kernel) {
+		log.Warn("execution forbidden")
+		return
+	}
+	release, ok := srv.limit(w, req, kernel)
+	if !ok {
+		return
+	}
+	defer release()
+
+	var (
+		snippets []*sandbox.Snippet
+		cells    []int
+	)
+	for i, cell := range notebook.Cells {
+		if cell.CellType != nbformat.CellTypeCode || strings.TrimSpace(string(cell.Source)) == "" {
+			continue
+		}
+		if skipped(&cell, options.skip) {
+			continue
+		}
+		snippets = append(snippets, &sandbox.Snippet{
+			ID:           uuid.New(),
+			Kernel:       kernel,
+			Source:       string(cell.Source),
+			Timeout:      options.timeout,
+			StoreHistory: true,
+		})
+		cells = append(cells, i)
+	}
+
+	results, err := srv.manager.ExecuteSequence(req.Context(), kernel, snippets, options.stop)
+	if err != nil {
+		srv.writeExecuteError(w, log, err)
+		return
+	}
+
+	for i, index := range cells {
+		cell := &notebook.Cells[index]
+		if i >= len(results) {
+			// The cells after the stop are cleared, so the notebook does not
+			// mix the fresh outputs with the stale ones.
+			cell.Outputs = nil
+			cell.ExecutionCount = nil
+			continue
+		}
+
+		result := results[i]
+		cell.Outputs = notebookOutputs(result)
+		cell.ExecutionCount = nil
+		if result.ExecutionCount > 0 {
+			count := result.ExecutionCount
+			cell.ExecutionCount = &count
+		}
+		if result.Status == sandbox.StatusTimeout {
+			cell.Outputs = append(cell.Outputs, nbformat.Output{
+				OutputType: nbformat.OutputTypeError,
+				Ename:      "TimeoutError",
+				Evalue:     "cell execution timed out",
+			})
+		}
+	}
+	log.Debug(
+		"notebook complete",
+		logging.Int("cells", len(snippets)),
+		logging.Int("executed", len(results)),
+	)
+
+	w.Header().Set("Content-Type", contentTypeNotebook)
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(notebook)
+	if err != nil {
+		log.Error("failed to write response", logging.Error(err))
+	}
+}
+
+// readNotebook reads the notebook and the execution options from the given
+// request. The options are the stop_on_error flag, the per-cell timeout, and
+// the skip_tag of the skipped cells, which can be repeated.
+func readNotebook(req *http.Request) (*nbformat.Notebook, notebookOptions, error) {
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, notebookOptions{}, fmt.Errorf("failed to read body: %w", err)
+	}
+
+	notebook, err := nbformat.Read(body)
+	if err != nil {
+		return nil, notebookOptions{}, err
+	}
+
+	query := req.URL.Query()
+	options := notebookOptions{skip: query["skip_tag"]}
+	if len(options.skip) == 0 {
+		options.skip = []string{defaultSkipTag}
+	}
+	if value := query.Get("stop_on_error"); value != "" {
+		options.stop, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, notebookOptions{}, fmt.Errorf("invalid stop_on_error: %w", err)
+		}
+	}
+	if value := query.Get("timeout"); value != "" {
+		options.timeout, err = time.ParseDuration(value)
+		if err != nil {
+			return nil, notebookOptions{}, fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+	return notebook, options, nil
+}
+
+// notebookKernel returns the name of the kernel executing the notebook. The
+// kernelspec of the notebook matches either the name of a kernel, or its
+// jupyter kernel.
+func (srv *Server) notebookKernel(req *http.Request, notebook *nbformat.Notebook) (string, error) {
+	if name := chi.URLParam(req, "kernel"); name != "" {
+		return strings.ToLower(name), nil
+	}
+
+	spec := notebook.KernelName()
+	if spec == "" {
+		return "", ErrNotebookKernel
+	}
+
+	kernels := srv.manager.Info()
+	for _, kernel := range kernels {
+		if strings.EqualFold(kernel.Name, spec) {
+			return kernel.Name, nil
+		}
+	}
+	for _, kernel := range kernels {
+		if kernel.Kernel == spec {
+			return kernel.Name, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", sandbox.ErrKernelNotFound, spec)
+}
+
+// skipped returns true if the cell is tagged with any of the given tags.
+func skipped(cell *nbformat.Cell, tags []string) bool {
+	for _, tag := range tags {
+		if cell.HasTag(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Well-known formats of the execution results.
+const (
+	formatDefault  = ""
+	formatNbformat = "nbformat"
+)
+
+// ErrUnknownFormat is returned when the requested result format is unknown.
+var ErrUnknownFormat = errors.New("unknown result format")
+
+// nbformatResult represents an execution result with the nbformat outputs,
+// which include the errors.
+type nbformatResult struct {
+	Status         string            `json:"status,omitempty"`
+	ExecutionCount *int              `json:"execution_count"`
+	Outputs        []nbformat.Output `json:"outputs"`
+
+	UserExpressions map[string]jupyter.UserExpression `json:"user_expressions,omitempty"`
+	Verdict         *sandbox.Verdict                  `json:"verdict,omitempty"`
+	Comparison      *sandbox.Comparison               `json:"comparison,omitempty"`
+}
+
+// readFormat returns the result format of the given request.
+func readFormat(req *http.Request) (string, error) {
+	format := req.URL.Query().Get("format")
+	switch format {
+	case formatDefault, formatNbformat:
+		return format, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+// formatResult returns the execution result in the given format.
+func formatResult(result *sandbox.Result, format string) any {
+	if format != formatNbformat {
+		return result
+	}
+
+	formatted := nbformatResult{
+		Status:          result.Status,
+		Outputs:         notebookOutputs(result),
+		UserExpressions: result.UserExpressions,
+		Verdict:         result.Verdict,
+		Comparison:      result.Comparison,
+	}
+	if result.ExecutionCount > 0 {
+		count := result.ExecutionCount
+		formatted.ExecutionCount = &count
+	}
+	return formatted
+}
+
+// notebookOutputs returns the outputs and the errors of the execution result
+// as nbformat outputs, in the order they were produced by the kernel.
+func notebookOutputs(result *sandbox.Result) []nbformat.Output {
+	outputs := make([]nbformat.Output, 0, len(result.Outputs)+len(result.Errors))
+
+	errs := result.Errors
+	flush := func(position int) {
+		for len(errs) > 0 && errs[0].Position <= position {
+			content, ok := errs[0].Data.(jupyter.MessageErrorContent)
+			errs = errs[1:]
+			if !ok {
+				continue
+			}
+			outputs = append(outputs, nbformat.Output{
+				OutputType: nbformat.OutputTypeError,
+				Ename:      content.EName,
+				Evalue:     content.EValue,
+				Traceback:  content.Traceback,
+			})
+		}
+	}
+
+	for i, output := range result.Outputs {
+		flush(i)
+
+		switch output.Kind {
+		case sandbox.OutputKindStream:
+			content, ok := output.Data.(jupyter.MessageStreamContent)
+			if !ok {
+				continue
+			}
+			outputs = append(outputs, nbformat.Output{
+				OutputType: nbformat.OutputTypeStream,
+				Name:       content.Name,
+				Text:       nbformat.Text(content.Text),
+			})
+		case sandbox.OutputKindDisplayData, sandbox.OutputKindUpdateDisplayData:
+			data, _ := output.Data.(map[string]any)
+			outputs = append(outputs, nbformat.Output{
+				OutputType: nbformat.OutputTypeDisplayData,
+				Data:       data,
+				Metadata:   output.Meta,
+			})
+		case sandbox.OutputKindExecuteResult:
+			data, _ := output.Data.(map[string]any)
+			count := result.ExecutionCount
+			outputs = append(outputs, nbformat.Output{
+				OutputType:     nbformat.OutputTypeExecuteResult,
+				Data:           data,
+				Metadata:       output.Meta,
+				ExecutionCount: &count,
+			})
+		}
+	}
+	flush(len(result.Outputs))
+
+	return outputs
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+	"github.com/uclatall/ckhub/pkg/nbformat"
+)
+
+const testNotebook = `{
+  "cells": [
+    {"cell_type": "markdown", "metadata": {}, "source": "# Exercise"},
+    {"cell_type": "code", "metadata": {}, "outputs": [], "execution_count": null, "source": "print(1)"},
+    {"cell_type": "code", "metadata": {"tags": ["skip-execution"]}, "outputs": [], "execution_count": 7, "source": "print(2)"},
+    {"cell_type": "code", "metadata": {}, "outputs": [], "execution_count": null, "source": "fail()"},
+    {"cell_type": "code", "metadata": {}, "outputs": [], "execution_count": 9, "source": "print(3)"}
+  ],
+  "metadata": {"kernelspec": {"name": "python3", "display_name": "Python 3"}},
+  "nbformat": 4,
+  "nbformat_minor": 5
+}`
+
+func TestServerNotebook(t *testing.T) {
+	jupyter := jupytertest.NewServer("", func(code string) jupytertest.Reply {
+		if code == "fail()" {
+			return jupytertest.Reply{
+				Outputs: []jupytertest.Output{jupytertest.Error("NameError", "fail")},
+				Status:  "error",
+			}
+		}
+		return jupytertest.Echo(code)
+	})
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+
+	run := func(path string) *nbformat.Notebook {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(testNotebook))
+		res := httptest.NewRecorder()
+		srv.mux.ServeHTTP(res, req)
+		if res.Code != http.StatusOK {
+			t.Fatalf("unexpected status: %d %s", res.Code, res.Body)
+		}
+		notebook, err := nbformat.Read(res.Body.Bytes())
+		if err != nil {
+			t.Fatalf("failed to read notebook: %v", err)
+		}
+		return notebook
+	}
+
+	notebook := run("/api/v1/notebooks")
+	cells := notebook.Cells
+	if len(cells[1].Outputs) != 1 || cells[1].Outputs[0].Text != "print(1)" || cells[1].ExecutionCount == nil {
+		t.Errorf("unexpected first cell: %+v", cells[1])
+	}
+	if cells[2].ExecutionCount == nil || *cells[2].ExecutionCount != 7 || len(cells[2].Outputs) != 0 {
+		t.Errorf("skipped cell is changed: %+v", cells[2])
+	}
+	if len(cells[3].Outputs) != 1 || cells[3].Outputs[0].OutputType != nbformat.OutputTypeError {
+		t.Errorf("unexpected failed cell: %+v", cells[3])
+	}
+	if len(cells[4].Outputs) != 1 || *cells[4].ExecutionCount <= *cells[1].ExecutionCount {
+		t.Errorf("unexpected last cell: %+v", cells[4])
+	}
+
+	notebook = run("/api/v1/notebooks/python?stop_on_error=true")
+	if last := notebook.Cells[4]; last.ExecutionCount != nil || len(last.Outputs) != 0 {
+		t.Errorf("cell after error is not cleared: %+v", last)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/notebooks", strings.NewReader(
+		strings.Replace(testNotebook, `"python3"`, `"julia"`, 1),
+	))
+	res := httptest.NewRecorder()
+	srv.mux.ServeHTTP(res, req)
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status of unknown kernel: %d", res.Code)
+	}
+	var message string
+	_ = json.NewDecoder(res.Body).Decode(&message)
+	if !strings.Contains(message, "julia") {
+		t.Errorf("unexpected error: %q", message)
+	}
+}
+
+func TestServerNotebookTimeout(t *testing.T) {
+	jupyter := jupytertest.NewServer("", func(code string) jupytertest.Reply {
+		return jupytertest.Reply{
+			Outputs: []jupytertest.Output{jupytertest.Stream("stdout", code)},
+			Hang:    code == "hang()",
+		}
+	})
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+	source := strings.Replace(testNotebook, `"fail()"`, `"hang()"`, 1)
+
+	run := func(query string) *nbformat.Notebook {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/notebooks?timeout=100ms"+query, strings.NewReader(source))
+		res := httptest.NewRecorder()
+		srv.mux.ServeHTTP(res, req)
+		if res.Code != http.StatusOK {
+			t.Fatalf("unexpected status: %d %s", res.Code, res.Body)
+		}
+		notebook, err := nbformat.Read(res.Body.Bytes())
+		if err != nil {
+			t.Fatalf("failed to read notebook: %v", err)
+		}
+		return notebook
+	}
+
+	cells := run("").Cells
+	hung := cells[3]
+	if len(hung.Outputs) != 2 || hung.Outputs[1].Ename != "TimeoutError" {
+		t.Errorf("unexpected timed out cell: %+v", hung)
+	}
+	if last := cells[4]; len(last.Outputs) != 1 || last.Outputs[0].Text != "print(3)" {
+		t.Errorf("cell after timeout is not executed: %+v", last)
+	}
+
+	cells = run("&stop_on_error=true").Cells
+	if last := cells[4]; last.ExecutionCount != nil || len(last.Outputs) != 0 {
+		t.Errorf("cell after timeout is not cleared: %+v", last)
+	}
+}
+
+func TestServerExecuteNbformat(t *testing.T) {
+	jupyter := jupytertest.NewServer("", func(code string) jupytertest.Reply {
+		return jupytertest.Reply{
+			Outputs: []jupytertest.Output{
+				jupytertest.Stream("stdout", "1\n2\n"),
+				jupytertest.ExecuteResult(map[string]any{"text/plain": "42"}),
+				jupytertest.Error("ValueError", "bad value"),
+				jupytertest.Stream("stderr", "cleanup\n"),
+			},
+			Status: "error",
+		}
+	})
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+
+	res := execute(srv, "/api/v1/execute/python?format=nbformat", "x")
+	if res.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d %s", res.Code, res.Body)
+	}
+	var result struct {
+		Status         string           `json:"status"`
+		ExecutionCount *int             `json:"execution_count"`
+		Outputs        []map[string]any `json:"outputs"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	if result.Status != "error" || result.ExecutionCount == nil {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	expected := []map[string]any{
+		{"output_type": "stream", "name": "stdout", "text": []any{"1\n", "2\n"}},
+		{
+			"output_type":     "execute_result",
+			"execution_count": float64(*result.ExecutionCount),
+			"data":            map[string]any{"text/plain": "42"},
+			"metadata":        map[string]any{},
+		},
+		{
+			"output_type": "error",
+			"ename":       "ValueError",
+			"evalue":      "bad value",
+			"traceback":   []any{"ValueError: bad value"},
+		},
+		{"output_type": "stream", "name": "stderr", "text": []any{"cleanup\n"}},
+	}
+	if !reflect.DeepEqual(result.Outputs, expected) {
+		t.Errorf("unexpected outputs: %v", result.Outputs)
+	}
+
+	if res = execute(srv, "/api/v1/execute/python?format=html", "x"); res.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status of unknown format: %d", res.Code)
+	}
+}
@@ -1,6 +1,9 @@
 package server
 
-import "github.com/uclatall/ckhub/pkg/logging"
+import (
+	"github.com/uclatall/ckhub/pkg/logging"
+	"github.com/uclatall/ckhub/pkg/metrics"
+)
 
 // Option is a generic interface of the server configuration option.
 type Option interface {
@@ -23,3 +26,20 @@ func Logger(log logging.Logger) OptionFunc {
 		return nil
 	}
 }
+
+// Metrics creates a new option that exposes metrics of the given registry.
+func Metrics(registry *metrics.Registry) OptionFunc {
+	return func(srv *Server) error {
+		srv.metrics = registry
+		return nil
+	}
+}
+
+// Authenticators creates a new option that adds the given authenticators to
+// the server. Requests must be accepted by one of them.
+func Authenticators(auth ...Authenticator) OptionFunc {
+	return func(srv *Server) error {
+		srv.auth = append(srv.auth, auth...)
+		return nil
+	}
+}
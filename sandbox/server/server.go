@@ -6,15 +6,20 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"mime"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"go.uber.org/multierr"
 
 	"github.com/uclatall/ckhub/pkg/logging"
+	"github.com/uclatall/ckhub/pkg/metrics"
 	"github.com/uclatall/ckhub/sandbox"
 )
 
@@ -22,9 +27,19 @@ import (
 type Server struct {
 	log     logging.Logger
 	manager *sandbox.Manager
+	metrics *metrics.Registry
 	mux     chi.Router
 
-	addr string
+	addr  string
+	retry time.Duration
+	auth  []Authenticator
+
+	proxies []*net.IPNet
+	limits  limits
+	cors    *cors
+
+	webhooks webhooks
+	batch    batch
 }
 
 // NewServer creates a new sandbox management server with the given options.
@@ -32,12 +47,13 @@ func NewServer(manager *sandbox.Manager, options ...Option) (*Server, error) {
 	server := &Server{
 		log:     logging.NopLogger(),
 		addr:    ":8080",
+		retry:   5 * time.Second,
 		manager: manager,
 		mux:     chi.NewRouter(),
-	}
 
-	server.mux.Get("/healthz", server.HealthCheck)
-	server.mux.Post("/api/v1/execute/{kernel}", server.Execute)
+		webhooks: newWebhooks(),
+		batch:    batch{parallelism: 4, items: 1000},
+	}
 
 	errs := make([]error, len(options))
 	for i, option := range options {
@@ -48,6 +64,34 @@ func NewServer(manager *sandbox.Manager, options ...Option) (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	server.mux.Use(server.handleCORS)
+	server.mux.Get("/healthz", server.HealthCheck)
+	if server.metrics != nil {
+		server.mux.Method(http.MethodGet, "/metrics", server.metrics)
+	}
+	server.mux.Group(func(mux chi.Router) {
+		mux.Use(server.authenticate)
+
+		mux.Get("/api/v1/kernels", server.ListKernels)
+		mux.Get("/api/v1/status", server.Status)
+		mux.Post("/api/v1/execute/{kernel}", server.Execute)
+		mux.Post("/api/v1/execute/{kernel}/stream", server.ExecuteStream)
+		mux.Get("/api/v1/execute/{kernel}/console", server.Console)
+		mux.Post("/api/v1/sessions/{kernel}", server.CreateSession)
+		mux.Post("/api/v1/sessions/{id}/execute", server.ExecuteSession)
+		mux.Delete("/api/v1/sessions/{id}", server.CloseSession)
+		mux.Post("/api/v1/jobs/{kernel}", server.CreateJob)
+		mux.Get("/api/v1/jobs/{id}", server.GetJob)
+		mux.Delete("/api/v1/jobs/{id}", server.CancelJob)
+		mux.Post("/api/v1/batch", server.ExecuteBatch)
+		mux.Post("/api/v1/notebooks", server.ExecuteNotebook)
+		mux.Post("/api/v1/notebooks/{kernel}", server.ExecuteNotebook)
+		mux.Post("/api/v1/complete/{kernel}", server.Complete)
+		mux.Post("/api/v1/inspect/{kernel}", server.Inspect)
+		mux.Post("/api/v1/is_complete/{kernel}", server.IsComplete)
+	})
+
 	return server, nil
 }
 
@@ -55,6 +99,7 @@ func NewServer(manager *sandbox.Manager, options ...Option) (*Server, error) {
 // the context is canceled, or any error occurs.
 func (srv *Server) Run(ctx context.Context) error {
 	log := srv.log
+	defer srv.webhooks.cancel()
 
 	lis, rerr := net.Listen("tcp", srv.addr)
 	if rerr != nil {
@@ -98,48 +143,240 @@ func (srv *Server) Run(ctx context.Context) error {
 	return nil
 }
 
-// Execute executes the code in the sandbox.
+// Execute executes the code in the sandbox. Requests accepting server-sent
+// events are served by ExecuteStream.
 func (srv *Server) Execute(w http.ResponseWriter, req *http.Request) {
-	log := srv.log.Hooks(logging.Span())
+	if strings.Contains(req.Header.Get("Accept"), contentTypeEvents) {
+		srv.ExecuteStream(w, req)
+		return
+	}
 
-	id := uuid.New()
+	log := srv.log.Hooks(logging.Span()).Fields(principalFields(req)...)
 
-	kernel := strings.ToLower(chi.URLParam(req, "kernel"))
-	log.Fields(logging.String("kernel", kernel), logging.Stringer("trace", id))
+	format, err := readFormat(req)
+	if err != nil {
+		_ = req.Body.Close()
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	snippet, err := readSnippet(req)
+	if err != nil {
+		log.Error("failed to read request", logging.Error(err))
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if snippet.Callback != "" {
+		writeError(w, http.StatusBadRequest, ErrCallbackUnsupported)
+		return
+	}
+	log = log.Fields(
+		logging.String("kernel", snippet.Kernel),
+		logging.Stringer("trace", snippet.ID),
+	)
+	if !authorize(w, req, snippet.Kernel) {
+		log.Warn("execution forbidden")
+		return
+	}
+	release, ok := srv.limit(w, req, snippet.Kernel)
+	if !ok {
+		return
+	}
+	defer release()
 
-	body, err := io.ReadAll(req.Body)
-	defer func() { _ = req.Body.Close() }()
+	result, err := srv.manager.ExecuteSnippet(req.Context(), snippet)
+	if err != nil {
+		srv.writeExecuteError(w, log, err)
+		return
+	}
+	log.Debug("execution complete", logging.String("status", result.Status))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(formatResult(result, format))
+	if err != nil {
+		log.Error("failed to write response", logging.Error(err))
+	}
+}
+
+// ExecuteStream executes the code in the sandbox, and streams its outputs to
+// the client as server-sent events while the execution is in progress.
+func (srv *Server) ExecuteStream(w http.ResponseWriter, req *http.Request) {
+	log := srv.log.Hooks(logging.Span()).Fields(principalFields(req)...)
+
+	snippet, err := readSnippet(req)
 	if err != nil {
 		log.Error("failed to read request", logging.Error(err))
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if snippet.Callback != "" {
+		writeError(w, http.StatusBadRequest, ErrCallbackUnsupported)
+		return
+	}
+	log = log.Fields(
+		logging.String("kernel", snippet.Kernel),
+		logging.Stringer("trace", snippet.ID),
+	)
+	if !authorize(w, req, snippet.Kernel) {
+		log.Warn("execution forbidden")
+		return
+	}
+	release, ok := srv.limit(w, req, snippet.Kernel)
+	if !ok {
+		return
+	}
+	defer release()
+
+	stream, err := newEventStream(w)
+	if err != nil {
+		log.Error("failed to start stream", logging.Error(err))
 		writeError(w, http.StatusInternalServerError, err)
 		return
 	}
+	snippet.Handler = stream
 
-	result, err := srv.manager.ExecuteSnippet(req.Context(), &sandbox.Snippet{
-		ID:     id,
-		Kernel: kernel,
-		Source: string(body),
-	})
+	result, err := srv.manager.ExecuteSnippet(req.Context(), snippet)
 	if err != nil {
-		if errors.Is(err, sandbox.ErrKernelNotFound) {
-			writeError(w, http.StatusBadRequest, err)
+		if !stream.Started() {
+			srv.writeExecuteError(w, log, err)
 			return
 		}
 		log.Error("failed to execute snippet", logging.Error(err))
-		writeError(w, http.StatusInternalServerError, err)
+		stream.Send(eventStatus, streamStatus{Message: err.Error()})
 		return
 	}
-	log.Debug("execution complete")
+	log.Debug("execution complete", logging.String("status", result.Status))
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(result)
-	if err != nil {
+	stream.Send(eventStatus, streamStatus{
+		Status:          result.Status,
+		UserExpressions: result.UserExpressions,
+		Verdict:         result.Verdict,
+		Comparison:      result.Comparison,
+	})
+	if err := stream.Err(); err != nil {
 		log.Error("failed to write response", logging.Error(err))
 	}
 }
 
-// HealthCheck returns a health check status of the service.
+const contentTypeJSON = "application/json"
+
+// ErrCheckConflict is returned when the request sets both the check source
+// and the check file.
+var ErrCheckConflict = errors.New("check and check_file are mutually exclusive")
+
+// executeRequest represents a structured body of the execution request.
+type executeRequest struct {
+	ID              uuid.UUID         `json:"id"`
+	Code            string            `json:"code"`
+	Timeout         string            `json:"timeout,omitempty"`
+	Silent          bool              `json:"silent"`
+	StoreHistory    bool              `json:"store_history"`
+	StopOnError     bool              `json:"stop_on_error"`
+	UserExpressions map[string]string `json:"user_expressions,omitempty"`
+	Metadata        map[string]any    `json:"metadata,omitempty"`
+	Check           string            `json:"check,omitempty"`
+	CheckFile       string            `json:"check_file,omitempty"`
+
+	Expect *sandbox.Expectation `json:"expect,omitempty"`
+
+	Callback string `json:"callback,omitempty"`
+}
+
+// readSnippet reads the snippet from the given execution request. The body of
+// the request is either a JSON encoded executeRequest, or the raw source code.
+func readSnippet(req *http.Request) (*sandbox.Snippet, error) {
+	body, err := io.ReadAll(req.Body)
+	defer func() { _ = req.Body.Close() }()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+
+	request := executeRequest{
+		Code:    string(body),
+		Timeout: req.URL.Query().Get("timeout"),
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType == contentTypeJSON {
+		timeout := request.Timeout
+		request = executeRequest{}
+		err = json.Unmarshal(body, &request)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode body: %w", err)
+		}
+		if request.Timeout == "" {
+			request.Timeout = timeout
+		}
+	}
+
+	return request.snippet(strings.ToLower(chi.URLParam(req, "kernel")))
+}
+
+// snippet returns the snippet of the request for the given kernel.
+func (request executeRequest) snippet(kernel string) (*sandbox.Snippet, error) {
+	if request.Check != "" && request.CheckFile != "" {
+		return nil, ErrCheckConflict
+	}
+
+	var timeout time.Duration
+	if request.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(request.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+
+	id := request.ID
+	if id == uuid.Nil {
+		id = uuid.New()
+	}
+
+	return &sandbox.Snippet{
+		ID:      id,
+		Kernel:  kernel,
+		Source:  request.Code,
+		Timeout: timeout,
+
+		Silent:          request.Silent,
+		StoreHistory:    request.StoreHistory,
+		StopOnError:     request.StopOnError,
+		UserExpressions: request.UserExpressions,
+		Metadata:        request.Metadata,
+
+		Check:     request.Check,
+		CheckFile: request.CheckFile,
+
+		Expect: request.Expect,
+
+		Callback: request.Callback,
+	}, nil
+}
+
+// writeExecuteError writes a response for the failed snippet execution.
+func (srv *Server) writeExecuteError(
+	w http.ResponseWriter,
+	log logging.Logger,
+	err error,
+) {
+	switch {
+	case errors.Is(err, sandbox.ErrKernelNotFound),
+		errors.Is(err, sandbox.ErrCheckNotFound):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, sandbox.ErrTooManyRequests):
+		log.Warn("execution rejected", logging.Error(err))
+		srv.writeRetry(w, http.StatusTooManyRequests, err)
+	case errors.Is(err, sandbox.ErrQueueTimeout):
+		log.Warn("execution rejected", logging.Error(err))
+		srv.writeRetry(w, http.StatusServiceUnavailable, err)
+	default:
+		log.Error("failed to execute snippet", logging.Error(err))
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// HealthCheck returns a health check status of the service. It's public, so
+// the state of the kernel pools is served by Status instead.
 func (srv *Server) HealthCheck(w http.ResponseWriter, req *http.Request) {
 	_ = req.Body.Close()
 	if req.URL.Query().Has("ready") && srv.manager.Kernels() == 0 {
@@ -149,6 +386,66 @@ func (srv *Server) HealthCheck(w http.ResponseWriter, req *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// statusResponse represents a status of the kernel pools.
+type statusResponse struct {
+	Kernels []sandbox.KernelStatus `json:"kernels"`
+}
+
+// Status returns the status of the kernel pools permitted to the principal,
+// along with their backends.
+func (srv *Server) Status(w http.ResponseWriter, req *http.Request) {
+	_ = req.Body.Close()
+
+	kernels := srv.manager.Status()
+	if principal := PrincipalFromContext(req.Context()); principal != nil {
+		permitted := kernels[:0]
+		for _, kernel := range kernels {
+			if principal.Permits(kernel.Name) {
+				permitted = append(permitted, kernel)
+			}
+		}
+		kernels = permitted
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(statusResponse{Kernels: kernels})
+}
+
+// kernelsResponse represents a list of the configured kernels.
+type kernelsResponse struct {
+	Kernels []sandbox.KernelInfo `json:"kernels"`
+}
+
+// ListKernels returns the configured kernels along with their languages and
+// the state of their pools.
+func (srv *Server) ListKernels(w http.ResponseWriter, req *http.Request) {
+	_ = req.Body.Close()
+
+	kernels := srv.manager.Info()
+	if principal := PrincipalFromContext(req.Context()); principal != nil {
+		permitted := kernels[:0]
+		for _, kernel := range kernels {
+			if principal.Permits(kernel.Name) {
+				permitted = append(permitted, kernel)
+			}
+		}
+		kernels = permitted
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(kernelsResponse{
+		Kernels: kernels,
+	})
+}
+
+func (srv *Server) writeRetry(w http.ResponseWriter, status int, err error) {
+	seconds := int(math.Ceil(srv.retry.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeError(w, status, err)
+}
+
 func writeError(w http.ResponseWriter, status int, err error) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
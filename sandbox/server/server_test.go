@@ -0,0 +1,385 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+	"github.com/uclatall/ckhub/pkg/metrics"
+	"github.com/uclatall/ckhub/sandbox"
+)
+
+// newTestServer creates a server with a manager of the given yaml
+// configuration, where the {url} placeholder is replaced with the address of
+// the given jupyter server.
+func newTestServer(t *testing.T, jupyter *jupytertest.Server, config string) *Server {
+	t.Helper()
+
+	srv, err := NewServer(newTestManager(t, jupyter, config))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	return srv
+}
+
+// newTestManager creates and runs a manager of the given yaml configuration
+// and options.
+func newTestManager(
+	t *testing.T,
+	jupyter *jupytertest.Server,
+	config string,
+	options ...sandbox.Option,
+) *sandbox.Manager {
+	t.Helper()
+
+	var cfg sandbox.Config
+	err := yaml.Unmarshal([]byte(strings.ReplaceAll(config, "{url}", jupyter.URL())), &cfg)
+	if err != nil {
+		t.Fatalf("failed to decode config: %v", err)
+	}
+
+	manager, err := sandbox.NewManager(append(options, cfg)...)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_ = manager.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return manager
+}
+
+func execute(srv *Server, path, code string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(code))
+	res := httptest.NewRecorder()
+	srv.mux.ServeHTTP(res, req)
+	return res
+}
+
+const testConfig = `
+kernels:
+  - name: python
+    kernel: python3
+    jupyter:
+      url: "{url}"
+    max: 1
+    queue:
+      size: 1
+      timeout: 5s
+`
+
+func TestServerExecute(t *testing.T) {
+	jupyter := jupytertest.NewServer("", func(code string) jupytertest.Reply {
+		return jupytertest.Reply{
+			Outputs: []jupytertest.Output{
+				jupytertest.Stream("stdout", code),
+				jupytertest.ExecuteResult(map[string]any{"text/plain": "42"}),
+			},
+		}
+	})
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+
+	res := execute(srv, "/api/v1/execute/Python", "print(42)")
+	if res.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d: %s", res.Code, res.Body)
+	}
+
+	var result struct {
+		Status  string `json:"status"`
+		Outputs []struct {
+			Type string         `json:"type"`
+			Data map[string]any `json:"data"`
+		} `json:"outputs"`
+	}
+	err := json.NewDecoder(res.Body).Decode(&result)
+	if err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if result.Status != sandbox.StatusOK {
+		t.Errorf("unexpected status: %q", result.Status)
+	}
+	if len(result.Outputs) != 2 {
+		t.Fatalf("unexpected number of outputs: %d", len(result.Outputs))
+	}
+	if result.Outputs[0].Type != "stream" || result.Outputs[0].Data["text"] != "print(42)" {
+		t.Errorf("unexpected stream output: %+v", result.Outputs[0])
+	}
+	if result.Outputs[1].Type != "execute_result" || result.Outputs[1].Data["text/plain"] != "42" {
+		t.Errorf("unexpected execute result: %+v", result.Outputs[1])
+	}
+}
+
+func TestServerExecuteTimeout(t *testing.T) {
+	jupyter := jupytertest.NewServer("", func(string) jupytertest.Reply {
+		return jupytertest.Reply{Hang: true}
+	})
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+
+	res := execute(srv, "/api/v1/execute/python?timeout=100ms", "while True: pass")
+	if res.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d: %s", res.Code, res.Body)
+	}
+	if !strings.Contains(res.Body.String(), `"status":"timeout"`) {
+		t.Errorf("unexpected response: %s", res.Body)
+	}
+}
+
+func TestServerExecuteErrors(t *testing.T) {
+	jupyter := jupytertest.NewServer("", nil)
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, `
+kernels:
+  - name: python
+    kernel: python3
+    jupyter:
+      url: "{url}"
+`)
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		retry  string
+	}{
+		{"unknown kernel", "/api/v1/execute/ruby", http.StatusBadRequest, ""},
+		{"invalid timeout", "/api/v1/execute/python?timeout=soon", http.StatusBadRequest, ""},
+		{"queue full", "/api/v1/execute/python", http.StatusTooManyRequests, "5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := execute(srv, tt.path, "print(42)")
+			if res.Code != tt.status {
+				t.Errorf("unexpected status code: %d: %s", res.Code, res.Body)
+			}
+			if retry := res.Header().Get("Retry-After"); retry != tt.retry {
+				t.Errorf("unexpected retry after header: %q", retry)
+			}
+		})
+	}
+}
+
+func TestServerExecuteJSON(t *testing.T) {
+	jupyter := jupytertest.NewServer("", nil)
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/execute/python", strings.NewReader(`{
+		"id": "6f1c1b8e-4d8a-4c55-a0a4-23d0c7b5e1a2",
+		"code": "x = 42",
+		"silent": true,
+		"store_history": true,
+		"stop_on_error": true,
+		"user_expressions": {"x": "x"},
+		"metadata": {"cell": "a1"}
+	}`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	res := httptest.NewRecorder()
+	srv.mux.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d: %s", res.Code, res.Body)
+	}
+
+	var requests []jupytertest.Request
+	for _, kernel := range jupyter.Kernels() {
+		requests = append(requests, kernel.Requests()...)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("unexpected number of requests: %d", len(requests))
+	}
+
+	request := requests[0]
+	if request.Content.Code != "x = 42" || !request.Content.Silent || !request.Content.StopOnError {
+		t.Errorf("unexpected request content: %+v", request.Content)
+	}
+	if request.Content.StoreHistory {
+		t.Error("history is stored for silent execution")
+	}
+	if request.Content.UserExpressions["x"] != "x" {
+		t.Errorf("unexpected user expressions: %v", request.Content.UserExpressions)
+	}
+	if request.MetaData["cell"] != "a1" {
+		t.Errorf("unexpected metadata: %v", request.MetaData)
+	}
+}
+
+func TestServerExecuteInvalidJSON(t *testing.T) {
+	jupyter := jupytertest.NewServer("", nil)
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/execute/python", strings.NewReader(`{"id": "invalid"}`))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+	srv.mux.ServeHTTP(res, req)
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status code: %d: %s", res.Code, res.Body)
+	}
+}
+
+func TestServerAssist(t *testing.T) {
+	jupyter := jupytertest.NewServer("", nil)
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig+`
+    assist:
+      size: 1
+`)
+
+	res := execute(srv, "/api/v1/is_complete/python", `{"code": "f(1,"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d %s", res.Code, res.Body)
+	}
+	var completeness sandbox.Completeness
+	err := json.NewDecoder(res.Body).Decode(&completeness)
+	if err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if completeness.Status != "incomplete" {
+		t.Errorf("unexpected status: %+v", completeness)
+	}
+
+	res = execute(srv, "/api/v1/complete/python", `{"code": "pri", "cursor_pos": 4}`)
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status of invalid cursor: %d", res.Code)
+	}
+
+	res = execute(srv, "/api/v1/inspect/python", `{"code": "print", "session": "`+uuid.NewString()+`"}`)
+	if res.Code != http.StatusNotFound {
+		t.Errorf("unexpected status of unknown session: %d", res.Code)
+	}
+}
+
+func TestServerListKernels(t *testing.T) {
+	jupyter := jupytertest.NewServer("", nil)
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/kernels", nil)
+	res := httptest.NewRecorder()
+	srv.mux.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", res.Code)
+	}
+
+	var body struct {
+		Kernels []sandbox.KernelInfo `json:"kernels"`
+	}
+	err := json.NewDecoder(res.Body).Decode(&body)
+	if err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(body.Kernels) != 1 || body.Kernels[0].Name != "python" || body.Kernels[0].Language != "python" {
+		t.Errorf("unexpected kernels: %+v", body.Kernels)
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	jupyter := jupytertest.NewServer("", nil)
+	defer jupyter.Close()
+
+	registry := metrics.NewRegistry()
+	srv, err := NewServer(newTestManager(t, jupyter, testConfig, sandbox.Metrics(registry)), Metrics(registry))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	res := execute(srv, "/api/v1/execute/python", "print(42)")
+	if res.Code != http.StatusOK {
+		t.Fatalf("unexpected status of execution: %d: %s", res.Code, res.Body)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	res = httptest.NewRecorder()
+	srv.mux.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", res.Code)
+	}
+
+	body := res.Body.String()
+	for _, line := range []string{
+		"# TYPE ckhub_executions_total counter\n",
+		`ckhub_executions_total{kernel="python",status="ok"} 1` + "\n",
+		`ckhub_execution_duration_seconds_bucket{kernel="python",le="+Inf"} 1` + "\n",
+		`ckhub_execution_duration_seconds_count{kernel="python"} 1` + "\n",
+		`ckhub_instances{kernel="python"} `,
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("metrics lack %q:\n%s", line, body)
+		}
+	}
+}
+
+func TestServerStatus(t *testing.T) {
+	jupyter := jupytertest.NewServer("", nil)
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+	err := Config{Auth: AuthConfig{Keys: []APIKey{
+		{Label: "python", Hash: hashKey("py"), Kernels: []string{"python"}},
+		{Label: "r", Hash: hashKey("r"), Kernels: []string{"ir"}},
+	}}}.Apply(srv)
+	if err != nil {
+		t.Fatalf("failed to configure auth: %v", err)
+	}
+
+	status := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		res := httptest.NewRecorder()
+		srv.mux.ServeHTTP(res, req)
+		return res
+	}
+
+	res := status("/healthz", "")
+	if res.Code != http.StatusOK || res.Body.Len() != 0 {
+		t.Errorf("unexpected health check: %d %s", res.Code, res.Body)
+	}
+	if res := status("/api/v1/status", ""); res.Code != http.StatusUnauthorized {
+		t.Errorf("unexpected status of anonymous request: %d", res.Code)
+	}
+
+	for key, expected := range map[string]int{"py": 1, "r": 0} {
+		res := status("/api/v1/status", key)
+		if res.Code != http.StatusOK {
+			t.Fatalf("unexpected status: %d", res.Code)
+		}
+		var body struct {
+			Kernels []sandbox.KernelStatus `json:"kernels"`
+		}
+		err := json.NewDecoder(res.Body).Decode(&body)
+		if err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if len(body.Kernels) != expected {
+			t.Errorf("unexpected kernels of %s: %+v", key, body.Kernels)
+		}
+		if expected > 0 && len(body.Kernels[0].Backends) != 1 {
+			t.Errorf("unexpected backends: %+v", body.Kernels[0].Backends)
+		}
+	}
+}
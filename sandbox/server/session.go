@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/uclatall/ckhub/pkg/logging"
+	"github.com/uclatall/ckhub/sandbox"
+)
+
+// sessionResponse represents a created session.
+type sessionResponse struct {
+	ID      uuid.UUID `json:"id"`
+	Kernel  string    `json:"kernel"`
+	Created time.Time `json:"created"`
+}
+
+// CreateSession creates a new stateful session for the kernel.
+func (srv *Server) CreateSession(w http.ResponseWriter, req *http.Request) {
+	_ = req.Body.Close()
+
+	kernel := strings.ToLower(chi.URLParam(req, "kernel"))
+	log := srv.log.Hooks(logging.Span()).Fields(principalFields(req)...).Fields(logging.String("kernel", kernel))
+	if !authorize(w, req, kernel) {
+		return
+	}
+	release, ok := srv.limit(w, req, kernel)
+	if !ok {
+		return
+	}
+	defer release()
+
+	session, err := srv.manager.CreateSession(req.Context(), kernel, owner(req))
+	if err != nil {
+		if errors.Is(err, sandbox.ErrTooManySessions) {
+			log.Warn("session rejected", logging.Error(err))
+			srv.writeRetry(w, http.StatusTooManyRequests, err)
+			return
+		}
+		srv.writeExecuteError(w, log, err)
+		return
+	}
+	log.Debug("session created", logging.Stringer("session", session.ID()))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(sessionResponse{
+		ID:      session.ID(),
+		Kernel:  session.Kernel(),
+		Created: session.Created(),
+	})
+	if err != nil {
+		log.Error("failed to write response", logging.Error(err))
+	}
+}
+
+// ExecuteSession executes the code in the session.
+func (srv *Server) ExecuteSession(w http.ResponseWriter, req *http.Request) {
+	log := srv.log.Hooks(logging.Span()).Fields(principalFields(req)...)
+
+	id, err := uuid.Parse(chi.URLParam(req, "id"))
+	if err != nil {
+		_ = req.Body.Close()
+		writeError(w, http.StatusNotFound, sandbox.ErrSessionNotFound)
+		return
+	}
+	format, err := readFormat(req)
+	if err != nil {
+		_ = req.Body.Close()
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	kernel, ok := srv.authorizeSession(w, req, id)
+	if !ok {
+		_ = req.Body.Close()
+		return
+	}
+	release, ok := srv.limit(w, req, kernel)
+	if !ok {
+		_ = req.Body.Close()
+		return
+	}
+	defer release()
+
+	snippet, err := readSnippet(req)
+	if err != nil {
+		log.Error("failed to read request", logging.Error(err))
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if snippet.Callback != "" {
+		writeError(w, http.StatusBadRequest, ErrCallbackUnsupported)
+		return
+	}
+	log = log.Fields(
+		logging.Stringer("session", id),
+		logging.Stringer("trace", snippet.ID),
+	)
+
+	result, err := srv.manager.ExecuteSession(req.Context(), id, snippet)
+	if err != nil {
+		if errors.Is(err, sandbox.ErrSessionNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		srv.writeExecuteError(w, log, err)
+		return
+	}
+	log.Debug("execution complete", logging.String("status", result.Status))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(formatResult(result, format))
+	if err != nil {
+		log.Error("failed to write response", logging.Error(err))
+	}
+}
+
+// CloseSession closes the session and releases its kernel.
+func (srv *Server) CloseSession(w http.ResponseWriter, req *http.Request) {
+	_ = req.Body.Close()
+
+	id, err := uuid.Parse(chi.URLParam(req, "id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, sandbox.ErrSessionNotFound)
+		return
+	}
+	if _, ok := srv.authorizeSession(w, req, id); !ok {
+		return
+	}
+
+	err = srv.manager.CloseSession(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	srv.log.Debug("session closed", logging.Stringer("session", id))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeSession returns the kernel of the given session if it's owned by
+// the principal of the request, who is still permitted to use the kernel, and
+// writes the error response otherwise. The sessions of other principals are
+// reported as missing.
+func (srv *Server) authorizeSession(w http.ResponseWriter, req *http.Request, id uuid.UUID) (string, bool) {
+	session, err := srv.manager.Session(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return "", false
+	}
+	if session.Owner() != owner(req) {
+		writeError(w, http.StatusNotFound, sandbox.ErrSessionNotFound)
+		return "", false
+	}
+	return session.Kernel(), authorize(w, req, session.Kernel())
+}
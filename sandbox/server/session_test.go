@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+	"github.com/uclatall/ckhub/sandbox"
+)
+
+func TestServerSession(t *testing.T) {
+	jupyter := jupytertest.NewServer("", jupytertest.Echo)
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		res := httptest.NewRecorder()
+		srv.mux.ServeHTTP(res, req)
+		return res
+	}
+
+	res := request(http.MethodPost, "/api/v1/sessions/Python", "")
+	if res.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code: %d: %s", res.Code, res.Body)
+	}
+	var session sessionResponse
+	if err := json.NewDecoder(res.Body).Decode(&session); err != nil {
+		t.Fatalf("failed to decode session: %v", err)
+	}
+	if session.Kernel != "python" || session.Created.IsZero() {
+		t.Errorf("unexpected session: %+v", session)
+	}
+	path := "/api/v1/sessions/" + session.ID.String()
+
+	for _, code := range []string{"x = 1", "print(x)"} {
+		res = request(http.MethodPost, path+"/execute", code)
+		if res.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: %d: %s", res.Code, res.Body)
+		}
+		var result struct {
+			Status string `json:"status"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+			t.Fatalf("failed to decode result: %v", err)
+		}
+		if result.Status != sandbox.StatusOK {
+			t.Errorf("unexpected status: %q", result.Status)
+		}
+	}
+	kernels := jupyter.Kernels()
+	if len(kernels) != 1 || strings.Join(kernels[0].Executions(), ";") != "x = 1;print(x)" {
+		t.Errorf("session executions are not kept in one kernel: %d", len(kernels))
+	}
+
+	// The session holds the only instance of the pool.
+	if res = request(http.MethodPost, "/api/v1/sessions/python", ""); res.Code != http.StatusTooManyRequests {
+		t.Errorf("unexpected status code over the limit: %d", res.Code)
+	}
+
+	if res = request(http.MethodDelete, path, ""); res.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status code of close: %d: %s", res.Code, res.Body)
+	}
+	if res = request(http.MethodPost, path+"/execute", "print(x)"); res.Code != http.StatusNotFound {
+		t.Errorf("unexpected status code of closed session: %d", res.Code)
+	}
+	if res = request(http.MethodDelete, path, ""); res.Code != http.StatusNotFound {
+		t.Errorf("unexpected status code of closing twice: %d", res.Code)
+	}
+	if res = request(http.MethodDelete, "/api/v1/sessions/"+uuid.NewString(), ""); res.Code != http.StatusNotFound {
+		t.Errorf("unexpected status code of unknown session: %d", res.Code)
+	}
+	if res = request(http.MethodPost, "/api/v1/sessions/session/execute", "print(x)"); res.Code != http.StatusNotFound {
+		t.Errorf("unexpected status code of invalid session: %d", res.Code)
+	}
+	if res = request(http.MethodPost, "/api/v1/sessions/ir", ""); res.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status code of unknown kernel: %d", res.Code)
+	}
+}
+
+func TestServerSessionOwner(t *testing.T) {
+	jupyter := jupytertest.NewServer("", jupytertest.Echo)
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+	err := Config{Auth: AuthConfig{Keys: []APIKey{
+		{Label: "alice", Hash: hashKey("a"), Kernels: []string{"python"}},
+		{Label: "bob", Hash: hashKey("b"), Kernels: []string{"python"}},
+	}}}.Apply(srv)
+	if err != nil {
+		t.Fatalf("failed to configure auth: %v", err)
+	}
+
+	request := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		res := httptest.NewRecorder()
+		srv.mux.ServeHTTP(res, req)
+		return res
+	}
+
+	res := request(http.MethodPost, "/api/v1/sessions/python", "a", "")
+	if res.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code: %d: %s", res.Code, res.Body)
+	}
+	var session sessionResponse
+	if err := json.NewDecoder(res.Body).Decode(&session); err != nil {
+		t.Fatalf("failed to decode session: %v", err)
+	}
+	path := "/api/v1/sessions/" + session.ID.String()
+	query := `{"code": "x", "session": "` + session.ID.String() + `"}`
+
+	if res := request(http.MethodPost, path+"/execute", "b", "print(1)"); res.Code != http.StatusNotFound {
+		t.Errorf("unexpected status code of foreign session: %d", res.Code)
+	}
+	if res := request(http.MethodPost, "/api/v1/complete/python", "b", query); res.Code != http.StatusNotFound {
+		t.Errorf("unexpected status code of foreign session query: %d", res.Code)
+	}
+	if res := request(http.MethodDelete, path, "b", ""); res.Code != http.StatusNotFound {
+		t.Errorf("unexpected status code of foreign session close: %d", res.Code)
+	}
+	if res := request(http.MethodPost, path+"/execute", "a", "print(1)"); res.Code != http.StatusOK {
+		t.Errorf("unexpected status code of own session: %d: %s", res.Code, res.Body)
+	}
+	if res := request(http.MethodDelete, path, "a", ""); res.Code != http.StatusNoContent {
+		t.Errorf("unexpected status code of own session close: %d", res.Code)
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/uclatall/ckhub/pkg/jupyter"
+	"github.com/uclatall/ckhub/sandbox"
+)
+
+const contentTypeEvents = "text/event-stream"
+
+// Well-known names of the server-sent events, besides the output kinds.
+const (
+	eventClearOutput = "clear_output"
+	eventError       = "execution_error"
+	eventStatus      = "status"
+)
+
+// streamStatus represents a final event of the execution stream.
+type streamStatus struct {
+	Status  string `json:"status,omitempty"`
+	Message string `json:"message,omitempty"`
+
+	UserExpressions map[string]jupyter.UserExpression `json:"user_expressions,omitempty"`
+	Verdict         *sandbox.Verdict                  `json:"verdict,omitempty"`
+	Comparison      *sandbox.Comparison               `json:"comparison,omitempty"`
+}
+
+// ErrStreamUnsupported is returned when the response writer does not support
+// streaming.
+var ErrStreamUnsupported = errors.New("streaming unsupported")
+
+// eventStream writes execution events to the client as server-sent events.
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	started bool
+	err     error
+}
+
+func newEventStream(w http.ResponseWriter) (*eventStream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, ErrStreamUnsupported
+	}
+	return &eventStream{w: w, flusher: flusher}, nil
+}
+
+// Handle sends the given execution event to the client.
+func (s *eventStream) Handle(event sandbox.Event) {
+	switch event.Kind {
+	case sandbox.EventKindOutput:
+		s.Send(event.Output.Kind.String(), event.Output)
+	case sandbox.EventKindError:
+		s.Send(eventError, event.Error)
+	case sandbox.EventKindClearOutput:
+		s.Send(eventClearOutput, struct{}{})
+	}
+}
+
+// Send sends an event with the given name and data to the client. The stream
+// headers are written before the first event.
+func (s *eventStream) Send(name string, data any) {
+	if s.err != nil {
+		return
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		s.err = fmt.Errorf("failed to encode event: %w", err)
+		return
+	}
+
+	if !s.started {
+		header := s.w.Header()
+		header.Set("Content-Type", contentTypeEvents)
+		header.Set("Cache-Control", "no-cache")
+		header.Set("X-Accel-Buffering", "no")
+		s.w.WriteHeader(http.StatusOK)
+		s.started = true
+	}
+
+	_, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", name, payload)
+	if err != nil {
+		s.err = fmt.Errorf("failed to write event: %w", err)
+		return
+	}
+	s.flusher.Flush()
+}
+
+// Started returns true if the stream headers are already written.
+func (s *eventStream) Started() bool {
+	return s.started
+}
+
+// Err returns the first error occurred while writing the stream.
+func (s *eventStream) Err() error {
+	return s.err
+}
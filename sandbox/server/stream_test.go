@@ -0,0 +1,107 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+	"github.com/uclatall/ckhub/sandbox"
+)
+
+// testEvent represents a decoded server-sent event.
+type testEvent struct {
+	Name string
+	Data map[string]any
+}
+
+// readEvents reads all server-sent events of the given response.
+func readEvents(t *testing.T, res *httptest.ResponseRecorder) []testEvent {
+	t.Helper()
+
+	var (
+		events []testEvent
+		event  testEvent
+	)
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event.Name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.Data)
+			if err != nil {
+				t.Fatalf("failed to decode event data: %v", err)
+			}
+		case line == "":
+			events = append(events, event)
+			event = testEvent{}
+		}
+	}
+	return events
+}
+
+func TestServerExecuteStream(t *testing.T) {
+	jupyter := jupytertest.NewServer("", func(code string) jupytertest.Reply {
+		return jupytertest.Reply{
+			Outputs: []jupytertest.Output{
+				jupytertest.Stream("stdout", code),
+				jupytertest.ClearOutput(false),
+				jupytertest.Error("ValueError", "boom"),
+			},
+			Status: sandbox.StatusError,
+		}
+	})
+	defer jupyter.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+
+	stream := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("print(42)"))
+		req.Header.Set("Accept", accept)
+		res := httptest.NewRecorder()
+		srv.mux.ServeHTTP(res, req)
+		return res
+	}
+
+	for _, res := range []*httptest.ResponseRecorder{
+		stream("/api/v1/execute/python/stream", ""),
+		stream("/api/v1/execute/python", contentTypeEvents),
+	} {
+		if res.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: %d: %s", res.Code, res.Body)
+		}
+		if contentType := res.Header().Get("Content-Type"); contentType != contentTypeEvents {
+			t.Errorf("unexpected content type: %q", contentType)
+		}
+
+		events := readEvents(t, res)
+		names := make([]string, len(events))
+		for i, event := range events {
+			names[i] = event.Name
+		}
+		expected := []string{"stream", eventClearOutput, eventError, eventStatus}
+		if strings.Join(names, ",") != strings.Join(expected, ",") {
+			t.Fatalf("unexpected events: %v", names)
+		}
+		if data, _ := events[0].Data["data"].(map[string]any); data["text"] != "print(42)" {
+			t.Errorf("unexpected stream event: %v", events[0].Data)
+		}
+		if status := events[3].Data["status"]; status != sandbox.StatusError {
+			t.Errorf("unexpected final status: %v", status)
+		}
+	}
+
+	// Errors before the first event are reported as usual responses.
+	res := stream("/api/v1/execute/ir/stream", "")
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status code of unknown kernel: %d", res.Code)
+	}
+	if contentType := res.Header().Get("Content-Type"); contentType == contentTypeEvents {
+		t.Errorf("unexpected content type of unknown kernel: %q", contentType)
+	}
+}
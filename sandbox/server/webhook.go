@@ -0,0 +1,319 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/uclatall/ckhub/pkg/logging"
+	"github.com/uclatall/ckhub/sandbox"
+)
+
+// WebhookConfig represents a configuration of the callbacks notifying clients
+// about the finished jobs. Callbacks are disabled unless hosts are set.
+type WebhookConfig struct {
+	// Hosts are the allowed hosts of the callback URLs. A host can match
+	// subdomains with a wildcard (*.example.org).
+	Hosts []string `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+	// Secret is the key of the HMAC-SHA256 signature of the callbacks.
+	Secret string `json:"secret,omitempty" yaml:"secret,omitempty"`
+	// Attempts is the maximum number of the delivery attempts.
+	Attempts uint `json:"attempts,omitempty" yaml:"attempts,omitempty"`
+	// Backoff is the delay before the first retry, doubled by each next one
+	// up to the MaxBackoff.
+	Backoff    time.Duration `json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	MaxBackoff time.Duration `json:"max_backoff,omitempty" yaml:"max_backoff,omitempty"`
+	// Timeout is the timeout of a single delivery attempt.
+	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// ErrInvalidWebhooks is returned when the webhooks configuration is invalid.
+var ErrInvalidWebhooks = errors.New("invalid webhooks configuration")
+
+// ErrCallbackNotAllowed is returned when the callback URL is not allowed.
+var ErrCallbackNotAllowed = errors.New("callback is not allowed")
+
+// ErrCallbackUnsupported is returned when the callback is requested for the
+// synchronous execution.
+var ErrCallbackUnsupported = errors.New("callback is supported by jobs only")
+
+// Headers of the callback requests.
+const (
+	headerSignature = "X-CKHub-Signature"
+	headerTimestamp = "X-CKHub-Timestamp"
+	headerJob       = "X-CKHub-Job"
+	headerAttempt   = "X-CKHub-Attempt"
+)
+
+// Well-known states of the callback.
+const (
+	CallbackPending   = "pending"
+	CallbackDelivered = "delivered"
+	CallbackFailed    = "failed"
+)
+
+// Delivery represents an attempt of the callback delivery.
+type Delivery struct {
+	Attempt int       `json:"attempt"`
+	Time    time.Time `json:"time"`
+	Status  int       `json:"status,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// CallbackStatus represents a state of the job callback along with its
+// delivery attempts.
+type CallbackStatus struct {
+	URL      string     `json:"url"`
+	State    string     `json:"state"`
+	Attempts []Delivery `json:"attempts,omitempty"`
+}
+
+// callback represents a callback of the job.
+type callback struct {
+	mu     sync.Mutex
+	status CallbackStatus
+}
+
+// webhooks contains the job callbacks of the server.
+type webhooks struct {
+	hosts      []string
+	secret     []byte
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	client     *http.Client
+
+	// ctx is canceled when the server stops, so the pending deliveries are
+	// abandoned.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	callbacks map[uuid.UUID]*callback
+}
+
+func newWebhooks() webhooks {
+	ctx, cancel := context.WithCancel(context.Background())
+	return webhooks{
+		attempts:   5,
+		backoff:    time.Second,
+		maxBackoff: time.Minute,
+		client:     newWebhookClient(10 * time.Second),
+		ctx:        ctx,
+		cancel:     cancel,
+		callbacks:  make(map[uuid.UUID]*callback),
+	}
+}
+
+// newWebhookClient creates a client of the callbacks with the given timeout.
+// Redirects are not followed, since their targets bypass the allowed hosts.
+func newWebhookClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Apply applies the webhooks configuration to the given server.
+func (cfg WebhookConfig) Apply(srv *Server) error {
+	if len(cfg.Hosts) > 0 && cfg.Secret == "" {
+		return fmt.Errorf("%w: secret is required", ErrInvalidWebhooks)
+	}
+
+	hooks := &srv.webhooks
+	hooks.hosts = make([]string, len(cfg.Hosts))
+	for i, host := range cfg.Hosts {
+		hooks.hosts[i] = strings.ToLower(host)
+	}
+	hooks.secret = []byte(cfg.Secret)
+	if cfg.Attempts > 0 {
+		hooks.attempts = int(cfg.Attempts)
+	}
+	if cfg.Backoff > 0 {
+		hooks.backoff = cfg.Backoff
+	}
+	if cfg.MaxBackoff > 0 {
+		hooks.maxBackoff = cfg.MaxBackoff
+	}
+	if cfg.Timeout > 0 {
+		hooks.client = newWebhookClient(cfg.Timeout)
+	}
+	return nil
+}
+
+// allows returns an error if the given callback URL is not allowed.
+func (hooks *webhooks) allows(callback string) error {
+	uri, err := url.Parse(callback)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCallbackNotAllowed, err)
+	}
+	if uri.Scheme != "http" && uri.Scheme != "https" {
+		return fmt.Errorf("%w: unsupported scheme %q", ErrCallbackNotAllowed, uri.Scheme)
+	}
+
+	host := strings.ToLower(uri.Hostname())
+	for _, allowed := range hooks.hosts {
+		if host == allowed {
+			return nil
+		}
+		if strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:]) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: host %q", ErrCallbackNotAllowed, host)
+}
+
+// register adds a pending callback of the given job. Callbacks of the expired
+// jobs are removed.
+func (srv *Server) register(job *sandbox.Job, target string) *callback {
+	cb := &callback{status: CallbackStatus{URL: target, State: CallbackPending}}
+
+	hooks := &srv.webhooks
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+
+	for id := range hooks.callbacks {
+		if _, err := srv.manager.Job(id); err != nil {
+			delete(hooks.callbacks, id)
+		}
+	}
+	hooks.callbacks[job.ID()] = cb
+	return cb
+}
+
+// callbackStatus returns the status of the callback of the given job, or nil
+// if the job has no callback.
+func (srv *Server) callbackStatus(id uuid.UUID) *CallbackStatus {
+	hooks := &srv.webhooks
+	hooks.mu.Lock()
+	cb, ok := hooks.callbacks[id]
+	hooks.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	status := cb.status
+	status.Attempts = append([]Delivery(nil), cb.status.Attempts...)
+	return &status
+}
+
+// deliver posts the status of the finished job to the callback URL, retrying
+// with exponential backoff until it's accepted, the attempts are exhausted,
+// or the server stops.
+func (srv *Server) deliver(log logging.Logger, job *sandbox.Job, cb *callback) {
+	hooks := &srv.webhooks
+
+	body, err := json.Marshal(job.Status())
+	if err != nil {
+		log.Error("failed to encode callback", logging.Error(err))
+		cb.finish(CallbackFailed)
+		return
+	}
+
+	delay := hooks.backoff
+	for attempt := 1; ; attempt++ {
+		status, err := hooks.post(cb.status.URL, job.ID(), attempt, body)
+
+		delivery := Delivery{Attempt: attempt, Time: time.Now(), Status: status}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		cb.record(delivery)
+
+		if err == nil {
+			log.Debug("callback delivered", logging.Int("attempt", attempt))
+			cb.finish(CallbackDelivered)
+			return
+		}
+		if attempt >= hooks.attempts {
+			log.Warn("failed to deliver callback", logging.Int("attempt", attempt), logging.Error(err))
+			cb.finish(CallbackFailed)
+			return
+		}
+
+		log.Debug("callback delivery failed", logging.Int("attempt", attempt), logging.Error(err))
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-hooks.ctx.Done():
+			timer.Stop()
+			log.Warn("callback delivery cancelled", logging.Int("attempt", attempt))
+			cb.finish(CallbackFailed)
+			return
+		}
+		delay *= 2
+		if delay > hooks.maxBackoff {
+			delay = hooks.maxBackoff
+		}
+	}
+}
+
+// post sends the signed callback request, and returns the response status.
+func (hooks *webhooks) post(target string, job uuid.UUID, attempt int, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(hooks.ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set(headerSignature, hooks.sign(timestamp, body))
+	req.Header.Set(headerTimestamp, timestamp)
+	req.Header.Set(headerJob, job.String())
+	req.Header.Set(headerAttempt, strconv.Itoa(attempt))
+
+	res, err := hooks.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	_ = res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// sign returns the signature of the callback body sent at the given time. The
+// timestamp is signed along with the body, so the receivers can reject the
+// replayed callbacks.
+func (hooks *webhooks) sign(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, hooks.secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (cb *callback) record(delivery Delivery) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.status.Attempts = append(cb.status.Attempts, delivery)
+}
+
+func (cb *callback) finish(state string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.status.State = state
+}
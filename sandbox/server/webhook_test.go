@@ -0,0 +1,248 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+)
+
+func TestWebhooksAllows(t *testing.T) {
+	srv := &Server{webhooks: newWebhooks()}
+	err := WebhookConfig{Hosts: []string{"grader.example.org"}}.Apply(srv)
+	if !errors.Is(err, ErrInvalidWebhooks) {
+		t.Errorf("unexpected error of missing secret: %v", err)
+	}
+
+	err = WebhookConfig{
+		Hosts:  []string{"Grader.example.org", "*.example.com"},
+		Secret: "secret",
+	}.Apply(srv)
+	if err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+
+	for callback, allowed := range map[string]bool{
+		"https://grader.example.org/hook":    true,
+		"http://grader.example.org:8080/":    true,
+		"ftp://grader.example.org/hook":      false,
+		"https://evil.example.org/hook":      false,
+		"https://a.b.example.com/hook":       true,
+		"https://example.com/hook":           false,
+		"https://grader.example.org.evil.io": false,
+	} {
+		err := srv.webhooks.allows(callback)
+		if (err == nil) != allowed {
+			t.Errorf("unexpected result of %s: %v", callback, err)
+		}
+	}
+}
+
+func TestServerWebhook(t *testing.T) {
+	jupyter := jupytertest.NewServer("", jupytertest.Echo)
+	defer jupyter.Close()
+
+	var attempts int32
+	received := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(req.Header.Get(headerTimestamp) + "."))
+		mac.Write(body)
+		if timestamp, err := strconv.ParseInt(req.Header.Get(headerTimestamp), 10, 64); err != nil ||
+			time.Since(time.Unix(timestamp, 0)) > time.Minute {
+			t.Errorf("unexpected timestamp: %q", req.Header.Get(headerTimestamp))
+		}
+		if req.Header.Get(headerSignature) != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("unexpected signature: %q", req.Header.Get(headerSignature))
+		}
+
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received <- body
+	}))
+	defer receiver.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+	err := WebhookConfig{
+		Hosts:   []string{"127.0.0.1"},
+		Secret:  "secret",
+		Backoff: 10 * time.Millisecond,
+	}.Apply(srv)
+	if err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+
+	submit := func(path, callback string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(
+			`{"code": "print(42)", "callback": "`+callback+`"}`,
+		))
+		req.Header.Set("Content-Type", contentTypeJSON)
+		res := httptest.NewRecorder()
+		srv.mux.ServeHTTP(res, req)
+		return res
+	}
+
+	if res := submit("/api/v1/jobs/python", "http://localhost/hook"); res.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status of unknown host: %d", res.Code)
+	}
+	if res := submit("/api/v1/execute/python", receiver.URL); res.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status of synchronous callback: %d", res.Code)
+	}
+
+	res := submit("/api/v1/jobs/python", receiver.URL+"/hook")
+	if res.Code != http.StatusAccepted {
+		t.Fatalf("unexpected status: %d %s", res.Code, res.Body)
+	}
+	var job struct {
+		ID uuid.UUID `json:"id"`
+	}
+	_ = json.NewDecoder(res.Body).Decode(&job)
+
+	select {
+	case body := <-received:
+		var status testJob
+		if err := json.Unmarshal(body, &status); err != nil {
+			t.Fatalf("failed to decode callback: %v", err)
+		}
+		if status.ID != job.ID || status.State != "done" || status.Result == nil {
+			t.Errorf("unexpected callback: %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback is not delivered")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		callback := srv.callbackStatus(job.ID)
+		if callback.State == CallbackDelivered {
+			if len(callback.Attempts) != 2 || callback.Attempts[0].Status != http.StatusServiceUnavailable {
+				t.Errorf("unexpected attempts: %+v", callback.Attempts)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected callback state: %s", callback.State)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServerWebhookRedirect(t *testing.T) {
+	jupyter := jupytertest.NewServer("", jupytertest.Echo)
+	defer jupyter.Close()
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t.Errorf("redirected callback is delivered to %s", req.URL)
+	}))
+	defer target.Close()
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, target.URL+"/internal", http.StatusTemporaryRedirect)
+	}))
+	defer receiver.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+	err := WebhookConfig{Hosts: []string{"127.0.0.1"}, Secret: "secret", Attempts: 1}.Apply(srv)
+	if err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/jobs/python", strings.NewReader(
+		`{"code": "print(42)", "callback": "`+receiver.URL+`/hook"}`,
+	))
+	req.Header.Set("Content-Type", contentTypeJSON)
+	res := httptest.NewRecorder()
+	srv.mux.ServeHTTP(res, req)
+	if res.Code != http.StatusAccepted {
+		t.Fatalf("unexpected status: %d %s", res.Code, res.Body)
+	}
+	var job struct {
+		ID uuid.UUID `json:"id"`
+	}
+	_ = json.NewDecoder(res.Body).Decode(&job)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		callback := srv.callbackStatus(job.ID)
+		if callback.State == CallbackFailed {
+			if len(callback.Attempts) != 1 || callback.Attempts[0].Status != http.StatusTemporaryRedirect {
+				t.Errorf("unexpected attempts: %+v", callback.Attempts)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected callback state: %s", callback.State)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServerWebhookCancel(t *testing.T) {
+	jupyter := jupytertest.NewServer("", jupytertest.Echo)
+	defer jupyter.Close()
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	srv := newTestServer(t, jupyter, testConfig)
+	err := WebhookConfig{Hosts: []string{"127.0.0.1"}, Secret: "secret", Backoff: time.Hour}.Apply(srv)
+	if err != nil {
+		t.Fatalf("failed to apply config: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/jobs/python", strings.NewReader(
+		`{"code": "print(42)", "callback": "`+receiver.URL+`/hook"}`,
+	))
+	req.Header.Set("Content-Type", contentTypeJSON)
+	res := httptest.NewRecorder()
+	srv.mux.ServeHTTP(res, req)
+	if res.Code != http.StatusAccepted {
+		t.Fatalf("unexpected status: %d %s", res.Code, res.Body)
+	}
+	var job struct {
+		ID uuid.UUID `json:"id"`
+	}
+	_ = json.NewDecoder(res.Body).Decode(&job)
+
+	// The first attempt fails, and the retry waits for the backoff.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(srv.callbackStatus(job.ID).Attempts) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("callback is not attempted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	srv.webhooks.cancel()
+	for {
+		callback := srv.callbackStatus(job.ID)
+		if callback.State == CallbackFailed {
+			if len(callback.Attempts) != 1 {
+				t.Errorf("unexpected attempts: %+v", callback.Attempts)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected callback state after cancel: %s", callback.State)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,159 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session represents a stateful execution session. It keeps the same kernel
+// instance across multiple executions, so the state defined by one snippet
+// is available for the following ones.
+type Session struct {
+	id       uuid.UUID
+	owner    string
+	kernel   *Kernel
+	instance *instance
+	created  time.Time
+
+	mu     sync.Mutex
+	closed bool
+	used   int64
+}
+
+// ErrSessionNotFound is returned when a session is not found.
+var ErrSessionNotFound = errors.New("session not found")
+
+// ErrTooManySessions is returned when the kernel is at its sessions limit.
+var ErrTooManySessions = errors.New("too many sessions")
+
+// ID returns the session identifier.
+func (s *Session) ID() uuid.UUID {
+	return s.id
+}
+
+// Owner returns the owner of the session, as given on creation.
+func (s *Session) Owner() string {
+	return s.owner
+}
+
+// Kernel returns the name of the session kernel.
+func (s *Session) Kernel() string {
+	return s.kernel.name
+}
+
+// Created returns the session creation time.
+func (s *Session) Created() time.Time {
+	return s.created
+}
+
+// ExecuteSnippet executes the given snippet in the session kernel instance.
+// The session is closed if the execution fails or times out, since the
+// instance state is unknown afterwards.
+func (s *Session) ExecuteSnippet(ctx context.Context, snippet *Snippet) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, ErrSessionNotFound
+	}
+	defer func() { atomic.StoreInt64(&s.used, time.Now().UnixNano()) }()
+
+	snippet.Kernel = s.kernel.name
+	result, err := s.kernel.executeSnippet(ctx, s.instance, snippet)
+
+	failed := err != nil || result.Status == StatusTimeout
+	if err == nil && snippet.Check != "" {
+		failed = s.kernel.checkSnippet(ctx, s.instance, snippet, result)
+	}
+	if err == nil && snippet.Expect != nil {
+		s.kernel.compareOutput(ctx, snippet, result)
+	}
+	if failed {
+		s.close()
+	}
+
+	return result, err
+}
+
+// Close closes the session and removes its kernel instance.
+func (s *Session) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.close()
+}
+
+// expire closes the session if it is idle or lived longer than the kernel
+// limits allow, and returns true if the session is closed. Busy sessions
+// never expire.
+func (s *Session) expire(now time.Time) bool {
+	if !s.mu.TryLock() {
+		return false
+	}
+	defer s.mu.Unlock()
+
+	used := time.Unix(0, atomic.LoadInt64(&s.used))
+	switch {
+	case s.closed:
+	case s.kernel.idle > 0 && now.Sub(used) > s.kernel.idle:
+	case s.kernel.lifetime > 0 && now.Sub(s.created) > s.kernel.lifetime:
+	default:
+		return false
+	}
+
+	s.close()
+	return true
+}
+
+// isClosed returns true if the session is closed.
+func (s *Session) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+func (s *Session) close() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+
+	go s.kernel.removeInstance(s.instance)
+	atomic.AddInt64(&s.kernel.sessions, -1)
+}
+
+// createSession creates a new session of the given owner with an instance
+// taken from the pool.
+func (k *Kernel) createSession(ctx context.Context, owner string) (*Session, error) {
+	for {
+		sessions := atomic.LoadInt64(&k.sessions)
+		if sessions >= k.maxSessions {
+			return nil, ErrTooManySessions
+		}
+		if atomic.CompareAndSwapInt64(&k.sessions, sessions, sessions+1) {
+			break
+		}
+	}
+
+	inst, err := k.acquireInstance(ctx)
+	if err != nil {
+		atomic.AddInt64(&k.sessions, -1)
+		return nil, err
+	}
+
+	now := time.Now()
+	return &Session{
+		id:       uuid.New(),
+		owner:    owner,
+		kernel:   k,
+		instance: inst,
+		created:  now,
+		used:     now.UnixNano(),
+	}, nil
+}
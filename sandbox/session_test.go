@@ -0,0 +1,189 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/uclatall/ckhub/pkg/jupyter/jupytertest"
+)
+
+func TestManagerSession(t *testing.T) {
+	srv := jupytertest.NewServer("", nil)
+	defer srv.Close()
+
+	// The sessions limit defaults to the pool size.
+	manager := newTestManager(t, `
+kernels:
+  - name: python
+    kernel: python3
+    max: 1
+    queue:
+      size: 1
+    jupyter:
+      url: "{url}"
+`, srv)
+
+	session, err := manager.CreateSession(context.Background(), "python", "")
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	if session.Kernel() != "python" {
+		t.Errorf("unexpected session kernel: %q", session.Kernel())
+	}
+
+	for _, source := range []string{"x = 1", "print(x)"} {
+		result, err := manager.ExecuteSession(context.Background(), session.ID(), &Snippet{
+			ID:     uuid.New(),
+			Source: source,
+		})
+		if err != nil {
+			t.Fatalf("failed to execute snippet: %v", err)
+		}
+		if result.Status != StatusOK {
+			t.Errorf("unexpected status: %q", result.Status)
+		}
+	}
+
+	kernels := srv.Kernels()
+	if len(kernels) != 1 {
+		t.Fatalf("unexpected number of kernels: %d", len(kernels))
+	}
+	if executions := kernels[0].Executions(); strings.Join(executions, ";") != "x = 1;print(x)" {
+		t.Errorf("unexpected executions: %v", executions)
+	}
+
+	err = manager.CloseSession(session.ID())
+	if err != nil {
+		t.Fatalf("failed to close session: %v", err)
+	}
+	eventually(t, func() bool { return len(srv.Kernels()) == 0 })
+
+	_, err = manager.ExecuteSession(context.Background(), session.ID(), &Snippet{
+		ID:     uuid.New(),
+		Source: "print(x)",
+	})
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("unexpected error of closed session: %v", err)
+	}
+	err = manager.CloseSession(session.ID())
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("unexpected error of closing twice: %v", err)
+	}
+}
+
+func TestManagerSessionLimit(t *testing.T) {
+	srv := jupytertest.NewServer("", nil)
+	defer srv.Close()
+
+	manager := newTestManager(t, `
+kernels:
+  - name: python
+    kernel: python3
+    max: 2
+    queue:
+      size: 1
+    sessions:
+      max: 1
+    jupyter:
+      url: "{url}"
+`, srv)
+
+	session, err := manager.CreateSession(context.Background(), "python", "")
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	_, err = manager.CreateSession(context.Background(), "python", "")
+	if !errors.Is(err, ErrTooManySessions) {
+		t.Fatalf("unexpected error over the limit: %v", err)
+	}
+
+	err = manager.CloseSession(session.ID())
+	if err != nil {
+		t.Fatalf("failed to close session: %v", err)
+	}
+
+	_, err = manager.CreateSession(context.Background(), "python", "")
+	if err != nil {
+		t.Errorf("failed to create session after close: %v", err)
+	}
+}
+
+func TestManagerSessionExpire(t *testing.T) {
+	srv := jupytertest.NewServer("", nil)
+	defer srv.Close()
+
+	manager := newTestManager(t, `
+kernels:
+  - name: python
+    kernel: python3
+    max: 1
+    queue:
+      size: 1
+    sessions:
+      idle: 1m
+    jupyter:
+      url: "{url}"
+`, srv)
+
+	session, err := manager.CreateSession(context.Background(), "python", "")
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	manager.expireSessions(time.Now())
+	if _, err := manager.Session(session.ID()); err != nil {
+		t.Fatalf("active session is expired: %v", err)
+	}
+
+	manager.expireSessions(time.Now().Add(2 * time.Minute))
+	if _, err := manager.Session(session.ID()); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("idle session is not expired: %v", err)
+	}
+	eventually(t, func() bool { return len(srv.Kernels()) == 0 })
+}
+
+func TestManagerSessionSolutionBusy(t *testing.T) {
+	srv := jupytertest.NewServer("", nil)
+	defer srv.Close()
+
+	manager := newTestManager(t, `
+kernels:
+  - name: python
+    kernel: python3
+    max: 1
+    queue:
+      size: 1
+    jupyter:
+      url: "{url}"
+`, srv)
+
+	session, err := manager.CreateSession(context.Background(), "python", "")
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	// The session holds the only instance, so the solution cannot run.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	result, err := manager.ExecuteSession(ctx, session.ID(), &Snippet{
+		ID:     uuid.New(),
+		Source: "print(1)",
+		Expect: &Expectation{Solution: "print(1)"},
+	})
+	if err != nil {
+		t.Fatalf("failed to execute snippet: %v", err)
+	}
+	if result.Status != StatusOK || len(result.Outputs) != 1 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if result.Comparison == nil || !strings.HasPrefix(result.Comparison.Message, "failed to run solution") {
+		t.Errorf("unexpected comparison: %+v", result.Comparison)
+	}
+}
@@ -3,36 +3,110 @@ package sandbox
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/uclatall/ckhub/pkg/jupyter"
 )
 
 // Snippet represents a snippet to be executed in the sandbox.
 type Snippet struct {
-	ID     uuid.UUID
-	Kernel string
-	Source string
+	ID      uuid.UUID
+	Kernel  string
+	Source  string
+	Timeout time.Duration
+	Handler Handler
+	Input   Input
+
+	// Options of the kernel execute request.
+	Silent          bool
+	StoreHistory    bool
+	StopOnError     bool
+	UserExpressions map[string]string
+	Metadata        map[string]any
+
+	// Check is a hidden snippet executed after the source in the same
+	// instance, which reports the verdict. CheckFile refers to a check in the
+	// checks directory instead.
+	Check     string
+	CheckFile string
+
+	// Expect is the expected output of the snippet.
+	Expect *Expectation
+
+	// Callback is the URL notified when the asynchronous job of the snippet
+	// is finished.
+	Callback string
 }
 
+// Well-known statuses of the snippet execution.
+const (
+	StatusOK      = "ok"
+	StatusError   = "error"
+	StatusTimeout = "timeout"
+)
+
 // Result represents a snippet execution result.
 type Result struct {
 	ID      uuid.UUID `json:"-"`
 	Status  string    `json:"status,omitempty"`
 	Errors  []Error   `json:"errors,omitempty"`
 	Outputs []Output  `json:"outputs,omitempty"`
+
+	// ExecutionCount is the counter of the kernel executions.
+	ExecutionCount int `json:"execution_count,omitempty"`
+
+	UserExpressions map[string]jupyter.UserExpression `json:"user_expressions,omitempty"`
+	Verdict         *Verdict                          `json:"verdict,omitempty"`
+	Comparison      *Comparison                       `json:"comparison,omitempty"`
 }
 
 // Error represents a snippet execution error.
 type Error struct {
 	Data any            `json:"data"`
 	Meta map[string]any `json:"metadata"`
+
+	// Position is the number of outputs produced before the error, so the
+	// error can be placed among the outputs in the order of the kernel.
+	Position int `json:"-"`
 }
 
 // Output represents a snippet execution output.
 type Output struct {
-	Kind OutputKind     `json:"type"`
-	Data any            `json:"data"`
-	Meta map[string]any `json:"metadata"`
+	Kind      OutputKind     `json:"type"`
+	Data      any            `json:"data"`
+	Meta      map[string]any `json:"metadata"`
+	DisplayID string         `json:"display_id,omitempty"`
+}
+
+// clear removes the outputs of the result. The errors are kept, and they are
+// placed before the outputs produced afterwards.
+func (r *Result) clear() {
+	r.Outputs = nil
+	for i := range r.Errors {
+		r.Errors[i].Position = 0
+	}
+}
+
+// update replaces the outputs displayed with the same identifier as the given
+// one, and returns false if there are no such outputs. The update without an
+// identifier matches nothing.
+func (r *Result) update(output Output) bool {
+	if output.DisplayID == "" {
+		return false
+	}
+
+	updated := false
+	for i := range r.Outputs {
+		if r.Outputs[i].DisplayID != output.DisplayID {
+			continue
+		}
+		r.Outputs[i].Data = output.Data
+		r.Outputs[i].Meta = output.Meta
+		updated = true
+	}
+	return updated
 }
 
 // OutputKind represetns an output kind.
@@ -43,6 +117,8 @@ const (
 	OutputKindNone OutputKind = iota
 	OutputKindDisplayData
 	OutputKindStream
+	OutputKindExecuteResult
+	OutputKindUpdateDisplayData
 	outputKindCount
 )
 
@@ -50,6 +126,8 @@ var outputKindOutput = []string{
 	"none",
 	"display_data",
 	"stream",
+	"execute_result",
+	"update_display_data",
 	"invalid",
 }
 
@@ -61,7 +139,7 @@ func (kind OutputKind) String() string {
 	return outputKindOutput[kind]
 }
 
-// ErrEventKindInvalid is returned when the output kind is invalid.
+// ErrEventKindInvalid is returned when the output or event kind is invalid.
 var ErrEventKindInvalid = errors.New("invalid output")
 
 // MarshalText marshals output kind into text form.